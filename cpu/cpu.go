@@ -38,8 +38,25 @@ type Interface interface {
 
 	// Step the simulation forward n cycles. Returns the number of cycles elapsed.
 	// This function may return early in some cases (like a HALT or breakpoint instruction).
+	// Memory wait cycles (see mem.Bus.WaitCycles) count as elapsed cycles,
+	// so the returned value may be slightly greater than n. Wait cycles
+	// accumulated by host accesses between calls to Step are not counted.
 	//
-	Step(n uint64) uint64
+	// If an instruction faults, Step stops and returns a *Fault error.
+	//
+	// The reason why Step returned is reported by Stopped.
+	//
+	Step(n uint64) (uint64, error)
+
+	// Stopped returns the reason why the last call to Step returned.
+	//
+	Stopped() StopInfo
+
+	// RequestStop requests the current or next call to Step to return before
+	// executing the next instruction, with reason StopRequest. It can be
+	// called from any goroutine.
+	//
+	RequestStop()
 
 	// SetPC set the Program Counter register to the given address.
 	//
@@ -52,4 +69,19 @@ type Interface interface {
 	// SP returns the current value of the Stack Pointer register.
 	//
 	SP() mirv.Address
+
+	// Registers returns the description of the CPU registers. Registers are
+	// numbered by their index in the returned slice, which must not be
+	// modified.
+	//
+	Registers() []Register
+
+	// Reg returns the value of register i. It panics if i is out of range.
+	//
+	Reg(i int) uint64
+
+	// SetReg sets the value of register i. Values wider than the register are
+	// truncated. It panics if i is out of range.
+	//
+	SetReg(i int, v uint64)
 }
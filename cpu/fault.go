@@ -0,0 +1,107 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cpu
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/mem"
+)
+
+// FaultKind is the kind of a CPU fault.
+//
+type FaultKind uint8
+
+// FaultKind values.
+//
+const (
+	FaultBus        FaultKind = iota // bus error on a data access
+	FaultFetch                       // bus error on an instruction fetch
+	FaultMisaligned                  // misaligned access
+	FaultDivide                      // integer division by zero
+)
+
+var faultNames = [...]string{
+	FaultBus:        "bus error",
+	FaultFetch:      "instruction fetch error",
+	FaultMisaligned: "misaligned access",
+	FaultDivide:     "division by zero",
+}
+
+func (k FaultKind) String() string {
+	if int(k) < len(faultNames) {
+		return faultNames[k]
+	}
+	return fmt.Sprintf("FaultKind(%d)", k)
+}
+
+// Fault is the error returned by Step when the execution of an instruction
+// faults. The CPU state is rolled back to the beginning of the faulting
+// instruction, so that PC is also the value returned by the CPU's PC method.
+// Memory writes performed by the instruction before the fault are not rolled
+// back.
+//
+type Fault struct {
+	Kind FaultKind
+	PC   mirv.Address // address of the faulting instruction
+	Addr mirv.Address // faulting address for memory faults
+	Size uint8        // access size in bytes for memory faults
+	Err  error        // underlying error
+}
+
+// NewFault returns a new Fault of the given kind for the error err. If err is
+// a bus error, the Addr and Size fields are set from err and misaligned
+// accesses are reported as FaultMisaligned. The PC field is left for the
+// caller to set.
+//
+func NewFault(kind FaultKind, err error) *Fault {
+	f := &Fault{Kind: kind, Err: err}
+	var (
+		be *mem.ErrBus
+		me *mem.ErrMisaligned
+	)
+	switch {
+	case errors.As(err, &be):
+		f.Addr, f.Size = be.Addr, be.Size
+		if be.Op == mem.OpFetch {
+			f.Kind = FaultFetch
+		}
+	case errors.As(err, &me):
+		f.Kind, f.Addr, f.Size = FaultMisaligned, me.Addr, me.Size
+	}
+	return f
+}
+
+func (f *Fault) Error() string {
+	switch f.Kind {
+	case FaultBus, FaultFetch, FaultMisaligned:
+		return fmt.Sprintf("%v @ PC %x: %d bytes @ address %x", f.Kind, f.PC, f.Size, f.Addr)
+	}
+	return fmt.Sprintf("%v @ PC %x", f.Kind, f.PC)
+}
+
+// Unwrap returns the underlying error.
+//
+func (f *Fault) Unwrap() error {
+	return f.Err
+}
@@ -0,0 +1,202 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cpu
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrBadFD is returned by Host implementations for invalid file descriptors.
+//
+var ErrBadFD = errors.New("bad file descriptor")
+
+// Host is the interface implemented by host I/O backends. CPU implementations
+// use it to emulate the system calls of guest programs (for example newlib's
+// read and write).
+//
+// File descriptors are guest file descriptors; 0, 1 and 2 are the guest's
+// standard input, output and error. Open flags are the os.O_* flags, CPU
+// implementations are responsible for converting guest flags.
+//
+type Host interface {
+	Open(name string, flags int, perm fs.FileMode) (fd int, err error)
+	Close(fd int) error
+	Read(fd int, p []byte) (n int, err error)
+	Write(fd int, p []byte) (n int, err error)
+	Seek(fd int, offset int64, whence int) (int64, error)
+	Stat(fd int) (fs.FileInfo, error)
+	Now() time.Time
+}
+
+// OSHost is a Host that gives guest programs access to the host's file
+// system. The guest's standard file descriptors are connected to Stdin,
+// Stdout and Stderr.
+//
+// The zero value is a valid OSHost with no standard I/O.
+//
+type OSHost struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	files map[int]*os.File
+}
+
+// NewOSHost returns a new OSHost connected to the standard I/O of the host
+// process.
+//
+func NewOSHost() *OSHost {
+	return &OSHost{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// StdioHost is a Host that only gives guest programs access to their standard
+// I/O. Opening files fails with fs.ErrPermission.
+//
+type StdioHost struct {
+	OSHost
+}
+
+// NewStdioHost returns a new StdioHost connected to the standard I/O of the
+// host process.
+//
+func NewStdioHost() *StdioHost {
+	return &StdioHost{OSHost{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}}
+}
+
+// Open implements Host. It always fails with fs.ErrPermission.
+//
+func (*StdioHost) Open(name string, flags int, perm fs.FileMode) (int, error) {
+	return -1, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+// Open implements Host. It returns the lowest free file descriptor above 2.
+//
+func (h *OSHost) Open(name string, flags int, perm fs.FileMode) (int, error) {
+	f, err := os.OpenFile(name, flags, perm)
+	if err != nil {
+		return -1, err
+	}
+	if h.files == nil {
+		h.files = make(map[int]*os.File)
+	}
+	fd := 3
+	for h.files[fd] != nil {
+		fd++
+	}
+	h.files[fd] = f
+	return fd, nil
+}
+
+// Close implements Host. Closing a standard file descriptor is a no-op.
+//
+func (h *OSHost) Close(fd int) error {
+	if fd >= 0 && fd <= 2 {
+		return nil
+	}
+	f := h.files[fd]
+	if f == nil {
+		return ErrBadFD
+	}
+	delete(h.files, fd)
+	return f.Close()
+}
+
+// Read implements Host.
+//
+func (h *OSHost) Read(fd int, p []byte) (int, error) {
+	if fd == 0 {
+		if h.Stdin == nil {
+			return 0, io.EOF
+		}
+		return h.Stdin.Read(p)
+	}
+	f := h.files[fd]
+	if f == nil {
+		return 0, ErrBadFD
+	}
+	return f.Read(p)
+}
+
+// Write implements Host.
+//
+func (h *OSHost) Write(fd int, p []byte) (int, error) {
+	var w io.Writer
+	switch fd {
+	case 1:
+		w = h.Stdout
+	case 2:
+		w = h.Stderr
+	default:
+		if f := h.files[fd]; f != nil {
+			w = f
+		}
+	}
+	if w == nil {
+		return 0, ErrBadFD
+	}
+	return w.Write(p)
+}
+
+// Seek implements Host. Seeking on standard file descriptors returns an error.
+//
+func (h *OSHost) Seek(fd int, offset int64, whence int) (int64, error) {
+	f := h.files[fd]
+	if f == nil {
+		if fd >= 0 && fd <= 2 {
+			return 0, fs.ErrInvalid
+		}
+		return 0, ErrBadFD
+	}
+	return f.Seek(offset, whence)
+}
+
+// Stat implements Host. Standard file descriptors are reported as character
+// devices.
+//
+func (h *OSHost) Stat(fd int) (fs.FileInfo, error) {
+	if fd >= 0 && fd <= 2 {
+		return stdio{}, nil
+	}
+	f := h.files[fd]
+	if f == nil {
+		return nil, ErrBadFD
+	}
+	return f.Stat()
+}
+
+// Now implements Host.
+//
+func (*OSHost) Now() time.Time { return time.Now() }
+
+// stdio is the fs.FileInfo of standard file descriptors.
+//
+type stdio struct{}
+
+func (stdio) Name() string       { return "stdio" }
+func (stdio) Size() int64        { return 0 }
+func (stdio) Mode() fs.FileMode  { return fs.ModeDevice | fs.ModeCharDevice | 0666 }
+func (stdio) ModTime() time.Time { return time.Time{} }
+func (stdio) IsDir() bool        { return false }
+func (stdio) Sys() interface{}   { return nil }
@@ -0,0 +1,81 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cpu
+
+import "errors"
+
+// ErrNoRegister is returned by ReadReg and WriteReg for unknown register names.
+//
+var ErrNoRegister = errors.New("no such register")
+
+// RegKind is the kind of a register.
+//
+type RegKind uint8
+
+// RegKind values.
+//
+const (
+	RegGeneral RegKind = iota // general purpose or other register
+	RegPC                     // program counter
+	RegSP                     // stack pointer
+	RegFlag                   // status flag or control bit
+)
+
+// Register describes a CPU register.
+//
+type Register struct {
+	Name string  // lower case name, as used by gdb
+	Bits uint8   // width in bits, at most 64
+	Kind RegKind // register kind
+}
+
+// RegIndex returns the index of the register with the given name, or -1 if c
+// has no such register.
+//
+func RegIndex(c Interface, name string) int {
+	for i, r := range c.Registers() {
+		if r.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ReadReg returns the value of the register with the given name.
+//
+func ReadReg(c Interface, name string) (uint64, error) {
+	i := RegIndex(c, name)
+	if i < 0 {
+		return 0, ErrNoRegister
+	}
+	return c.Reg(i), nil
+}
+
+// WriteReg sets the value of the register with the given name.
+//
+func WriteReg(c Interface, name string, v uint64) error {
+	i := RegIndex(c, name)
+	if i < 0 {
+		return ErrNoRegister
+	}
+	c.SetReg(i, v)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cpu
+
+import "fmt"
+
+// StopReason indicates why Step returned.
+//
+type StopReason uint8
+
+// StopReason values.
+//
+const (
+	StopBudget     StopReason = iota // the requested number of cycles elapsed
+	StopBreakpoint                   // breakpoint instruction
+	StopExit                         // the guest program exited, see StopInfo.Code
+	StopFault                        // an instruction faulted, see StopInfo.Fault
+	StopHalt                         // halt or wait for interrupt instruction
+	StopRequest                      // stop requested with RequestStop
+)
+
+var stopNames = [...]string{
+	StopBudget:     "budget exhausted",
+	StopBreakpoint: "breakpoint",
+	StopExit:       "exit",
+	StopFault:      "fault",
+	StopHalt:       "halt",
+	StopRequest:    "stop request",
+}
+
+func (r StopReason) String() string {
+	if int(r) < len(stopNames) {
+		return stopNames[r]
+	}
+	return fmt.Sprintf("StopReason(%d)", r)
+}
+
+// StopInfo describes why the last call to Step returned.
+//
+type StopInfo struct {
+	Reason StopReason
+	Code   int    // exit code for StopExit
+	Fault  *Fault // fault for StopFault
+}
+
+func (i StopInfo) String() string {
+	switch i.Reason {
+	case StopExit:
+		return fmt.Sprintf("%v (code %d)", i.Reason, i.Code)
+	case StopFault:
+		return i.Fault.Error()
+	}
+	return i.Reason.String()
+}
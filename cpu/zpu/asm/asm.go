@@ -0,0 +1,612 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package asm implements a small assembler for the ZPU.
+//
+// The assembler accepts the subset of the GNU as syntax used by the test
+// programs in cpu/zpu/testdata:
+//
+//	        .org 32
+//	        .balign 32, 0
+//	        .globl _start
+//	_start:
+//	        im _data        ; comment
+//	        load
+//	        im 0f
+//	        poppc
+//	0:      breakpoint
+//
+//	        .data
+//	_data:  .int 0xABCD0123
+//
+// Supported directives are .text, .data, .org, .balign, .byte, .short, .int,
+// .long and .globl (which is ignored since all symbols are global). Operands
+// are constant expressions made of numbers, symbols and numeric local label
+// references (like 0f or 1b) combined with + and -. Comments start with ; or
+// #.
+//
+// Instructions and directives are laid out like zpu-elf-gcc does: .text starts
+// at address 0 and is followed by .data. Sections are aligned and padded to
+// their largest .balign. An im instruction with a constant operand is encoded
+// with the minimum number of bytes. An im instruction referring to a symbol is
+// 5 bytes long and relaxed like the GNU linker does: its minimal encoding is
+// preceded by nop instructions.
+//
+package asm
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/mem"
+)
+
+// Error is the error returned by Assemble for invalid source code.
+//
+type Error struct {
+	Line int // line number, starting at 1
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Section is a section of an assembled program.
+//
+type Section struct {
+	Name  string       // section name: ".text" or ".data"
+	Addr  mirv.Address // load address
+	Align mirv.Address // alignment
+	Data  []byte
+}
+
+// Program is an assembled program.
+//
+type Program struct {
+	Sections []Section               // non-empty sections in address order
+	Symbols  map[string]mirv.Address // symbol values
+	Entry    mirv.Address            // value of _start if defined, start of .text otherwise
+}
+
+// Raw returns the memory image of the program, from address 0 to the end of
+// the last section. Gaps between sections are filled with zeros.
+//
+func (p *Program) Raw() []byte {
+	var n mirv.Address
+	for i := range p.Sections {
+		if e := p.Sections[i].Addr + mirv.Address(len(p.Sections[i].Data)); e > n {
+			n = e
+		}
+	}
+	img := make([]byte, n)
+	for i := range p.Sections {
+		copy(img[p.Sections[i].Addr:], p.Sections[i].Data)
+	}
+	return img
+}
+
+// Load copies the program sections to memory.
+//
+func (p *Program) Load(b *mem.Bus) error {
+	for i := range p.Sections {
+		if _, err := b.CopyIn(p.Sections[i].Addr, p.Sections[i].Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var opcodes = map[string]byte{
+	"breakpoint":       0x00,
+	"pushsp":           0x02,
+	"poppc":            0x04,
+	"add":              0x05,
+	"and":              0x06,
+	"or":               0x07,
+	"load":             0x08,
+	"not":              0x09,
+	"flip":             0x0A,
+	"nop":              0x0B,
+	"store":            0x0C,
+	"popsp":            0x0D,
+	"loadh":            34,
+	"storeh":           35,
+	"lessthan":         36,
+	"lessthanorequal":  37,
+	"ulessthan":        38,
+	"ulessthanorequal": 39,
+	"swap":             40,
+	"mult":             41,
+	"lshiftright":      42,
+	"ashiftleft":       43,
+	"ashiftright":      44,
+	"call":             45,
+	"eq":               46,
+	"neq":              47,
+	"neg":              48,
+	"sub":              49,
+	"xor":              50,
+	"loadb":            51,
+	"storeb":           52,
+	"div":              53,
+	"mod":              54,
+	"eqbranch":         55,
+	"neqbranch":        56,
+	"poppcrel":         57,
+	"config":           58,
+	"pushpc":           59,
+	"syscall":          60,
+	"pushspadd":        61,
+	"mult16x16":        62,
+	"callpcrel":        63,
+}
+
+// instructions with a constant operand: base opcode, operand scale and range.
+//
+var operandOps = map[string]struct {
+	op       byte
+	scale    int64
+	min, max int64
+}{
+	"storesp": {0x40, 4, 0, 124},
+	"loadsp":  {0x60, 4, 0, 124},
+	"addsp":   {0x10, 4, 0, 60},
+	"emulate": {0x20, 1, 0, 31},
+}
+
+var dataSizes = map[string]int{
+	".byte":  1,
+	".short": 2,
+	".int":   4,
+	".long":  4,
+}
+
+const (
+	secText = iota
+	secData
+)
+
+var sectionNames = [...]string{secText: ".text", secData: ".data"}
+
+type stmt struct {
+	line  int
+	label string // label definition if op is empty
+	op    string
+	args  []string
+	sect  int
+	off   mirv.Address // offset in section
+	size  mirv.Address
+	val   int64 // constant operand or padding byte
+}
+
+type section struct {
+	addr  mirv.Address
+	size  mirv.Address
+	align mirv.Address
+	data  []byte
+}
+
+type assembler struct {
+	stmts  []stmt
+	sects  [len(sectionNames)]section
+	syms   map[string]int   // symbol -> defining statement
+	locals map[string][]int // numeric label -> defining statements
+}
+
+// Assemble assembles the source code src. The returned error, if any, is an
+// *Error.
+//
+func Assemble(src string) (*Program, error) {
+	a := assembler{
+		syms:   make(map[string]int),
+		locals: make(map[string][]int),
+	}
+	for i, l := range strings.Split(src, "\n") {
+		if err := a.parse(i+1, l); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.layout(); err != nil {
+		return nil, err
+	}
+	if err := a.emit(); err != nil {
+		return nil, err
+	}
+
+	p := &Program{Symbols: make(map[string]mirv.Address, len(a.syms))}
+	for name, i := range a.syms {
+		p.Symbols[name] = a.addr(i)
+	}
+	p.Entry = a.sects[secText].addr
+	if e, ok := p.Symbols["_start"]; ok {
+		p.Entry = e
+	}
+	for i := range a.sects {
+		if s := &a.sects[i]; len(s.data) > 0 {
+			p.Sections = append(p.Sections, Section{Name: sectionNames[i], Addr: s.addr, Align: s.align, Data: s.data})
+		}
+	}
+	return p, nil
+}
+
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '$'
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parse parses a source line.
+//
+func (a *assembler) parse(line int, l string) error {
+	if i := strings.IndexAny(l, ";#"); i >= 0 {
+		l = l[:i]
+	}
+	l = strings.TrimSpace(l)
+	// labels
+	for {
+		i := 0
+		for i < len(l) && isIdent(l[i]) {
+			i++
+		}
+		r := strings.TrimLeft(l[i:], " \t")
+		if i == 0 || r == "" || r[0] != ':' {
+			break
+		}
+		name := l[:i]
+		if isDigits(name) {
+			a.locals[name] = append(a.locals[name], len(a.stmts))
+		} else {
+			if _, ok := a.syms[name]; ok {
+				return &Error{line, fmt.Sprintf("symbol %s already defined", name)}
+			}
+			a.syms[name] = len(a.stmts)
+		}
+		a.stmts = append(a.stmts, stmt{line: line, label: name})
+		l = strings.TrimSpace(r[1:])
+	}
+	if l == "" {
+		return nil
+	}
+	s := stmt{line: line}
+	if i := strings.IndexAny(l, " \t"); i >= 0 {
+		s.op, l = l[:i], strings.TrimSpace(l[i:])
+		for _, arg := range strings.Split(l, ",") {
+			s.args = append(s.args, strings.TrimSpace(arg))
+		}
+	} else {
+		s.op = l
+	}
+	s.op = strings.ToLower(s.op)
+	a.stmts = append(a.stmts, s)
+	return nil
+}
+
+// addr returns the address of statement i. Only valid after layout.
+//
+func (a *assembler) addr(i int) mirv.Address {
+	s := &a.stmts[i]
+	return a.sects[s.sect].addr + s.off
+}
+
+// eval evaluates the expression expr in statement pos. If resolve is false,
+// symbols evaluate to 0. sym reports whether the expression refers to any
+// symbol.
+//
+func (a *assembler) eval(expr string, pos int, resolve bool) (v int64, sym bool, err error) {
+	line := a.stmts[pos].line
+	s := expr
+	for {
+		neg := false
+		for {
+			s = strings.TrimLeft(s, " \t")
+			if s == "" || s[0] != '-' && s[0] != '+' {
+				break
+			}
+			neg = neg != (s[0] == '-')
+			s = s[1:]
+		}
+		i := 0
+		for i < len(s) && isIdent(s[i]) {
+			i++
+		}
+		if i == 0 {
+			return 0, sym, &Error{line, fmt.Sprintf("invalid expression %q", expr)}
+		}
+		var t int64
+		tok := s[:i]
+		s = strings.TrimLeft(s[i:], " \t")
+		switch n := len(tok) - 1; {
+		case isDigits(tok[:n]) && (tok[n] == 'b' || tok[n] == 'f'):
+			sym = true
+			if resolve {
+				d := a.local(tok[:n], pos, tok[n] == 'f')
+				if d < 0 {
+					return 0, sym, &Error{line, fmt.Sprintf("undefined local label %s", tok)}
+				}
+				t = int64(a.addr(d))
+			}
+		case tok[0] >= '0' && tok[0] <= '9':
+			u, err := strconv.ParseUint(tok, 0, 64)
+			if err != nil {
+				return 0, sym, &Error{line, fmt.Sprintf("invalid number %s", tok)}
+			}
+			t = int64(u)
+		default:
+			sym = true
+			if resolve {
+				d, ok := a.syms[tok]
+				if !ok {
+					return 0, sym, &Error{line, fmt.Sprintf("undefined symbol %s", tok)}
+				}
+				t = int64(a.addr(d))
+			}
+		}
+		if neg {
+			t = -t
+		}
+		v += t
+		if s == "" {
+			return v, sym, nil
+		}
+		if s[0] != '+' && s[0] != '-' {
+			return 0, sym, &Error{line, fmt.Sprintf("invalid expression %q", expr)}
+		}
+	}
+}
+
+// local returns the statement defining the numeric local label n referred to
+// by statement pos, or -1 if there is no such label.
+//
+func (a *assembler) local(n string, pos int, forward bool) int {
+	defs := a.locals[n]
+	if forward {
+		for _, d := range defs {
+			if d > pos {
+				return d
+			}
+		}
+		return -1
+	}
+	for i := len(defs) - 1; i >= 0; i-- {
+		if defs[i] < pos {
+			return defs[i]
+		}
+	}
+	return -1
+}
+
+// constant evaluates the i-th argument of statement pos, which must be a
+// constant expression.
+//
+func (a *assembler) constant(pos, i int) (int64, error) {
+	s := &a.stmts[pos]
+	v, sym, err := a.eval(s.args[i], pos, false)
+	if err == nil && sym {
+		err = &Error{s.line, fmt.Sprintf("%s: operand must be a constant", s.op)}
+	}
+	return v, err
+}
+
+// nargs checks the number of arguments of s.
+//
+func nargs(s *stmt, min, max int) error {
+	if n := len(s.args); n < min || n > max {
+		return &Error{s.line, fmt.Sprintf("%s: wrong number of operands", s.op)}
+	}
+	return nil
+}
+
+// imSize returns the minimum number of IM instructions needed to push v.
+//
+func imSize(v uint32) mirv.Address {
+	x := int32(v)
+	n := mirv.Address(1)
+	for ; n < 5; n++ {
+		if s := x >> (7*n - 1); s == 0 || s == -1 {
+			break
+		}
+	}
+	return n
+}
+
+// layout computes the offset and size of every statement, and section
+// addresses.
+//
+func (a *assembler) layout() error {
+	sect := secText
+	for i := range a.sects {
+		a.sects[i].align = 1
+	}
+	for pos := range a.stmts {
+		s := &a.stmts[pos]
+		cur := &a.sects[sect]
+		s.sect, s.off = sect, cur.size
+		if s.op == "" {
+			continue
+		}
+		var err error
+		switch s.op {
+		case ".text", ".data":
+			if err = nargs(s, 0, 0); err == nil {
+				sect = secText
+				if s.op == ".data" {
+					sect = secData
+				}
+			}
+		case ".globl", ".global":
+			err = nargs(s, 1, 1)
+		case ".org", ".balign":
+			if err = nargs(s, 1, 2); err != nil {
+				break
+			}
+			var v int64
+			if v, err = a.constant(pos, 0); err != nil {
+				break
+			}
+			if len(s.args) > 1 {
+				if s.val, err = a.constant(pos, 1); err != nil {
+					break
+				}
+			}
+			if s.op == ".org" {
+				if v < int64(cur.size) {
+					err = &Error{s.line, ".org: cannot move location counter backwards"}
+					break
+				}
+				s.size = mirv.Address(v) - cur.size
+			} else {
+				if v <= 0 || bits.OnesCount64(uint64(v)) != 1 {
+					err = &Error{s.line, ".balign: alignment must be a power of 2"}
+					break
+				}
+				al := mirv.Address(v)
+				s.size = (al - cur.size%al) % al
+				if al > cur.align {
+					cur.align = al
+				}
+			}
+		case "im":
+			if err = nargs(s, 1, 1); err != nil {
+				break
+			}
+			var (
+				v   int64
+				sym bool
+			)
+			if v, sym, err = a.eval(s.args[0], pos, false); err == nil {
+				s.size = 5
+				if !sym {
+					s.size = imSize(uint32(v))
+				}
+			}
+		default:
+			if n, ok := dataSizes[s.op]; ok {
+				if err = nargs(s, 1, 1<<30); err == nil {
+					s.size = mirv.Address(n * len(s.args))
+				}
+				break
+			}
+			if o, ok := operandOps[s.op]; ok {
+				if err = nargs(s, 1, 1); err != nil {
+					break
+				}
+				if s.val, err = a.constant(pos, 0); err != nil {
+					break
+				}
+				if s.val < o.min || s.val > o.max || s.val%o.scale != 0 {
+					err = &Error{s.line, fmt.Sprintf("%s: invalid operand %d", s.op, s.val)}
+					break
+				}
+				s.size = 1
+				break
+			}
+			if _, ok := opcodes[s.op]; ok {
+				err = nargs(s, 0, 0)
+				s.size = 1
+				break
+			}
+			err = &Error{s.line, fmt.Sprintf("unknown instruction or directive %s", s.op)}
+		}
+		if err != nil {
+			return err
+		}
+		cur.size += s.size
+	}
+
+	// pad sections to their alignment and place .data after .text
+	var addr mirv.Address
+	for i := range a.sects {
+		s := &a.sects[i]
+		s.size = (s.size + s.align - 1) &^ (s.align - 1)
+		s.addr = (addr + s.align - 1) &^ (s.align - 1)
+		addr = s.addr + s.size
+	}
+	return nil
+}
+
+// emit generates code.
+//
+func (a *assembler) emit() error {
+	for pos := range a.stmts {
+		s := &a.stmts[pos]
+		sect := &a.sects[s.sect]
+		switch {
+		case s.op == "":
+		case s.op == ".org" || s.op == ".balign":
+			for i := mirv.Address(0); i < s.size; i++ {
+				sect.data = append(sect.data, byte(s.val))
+			}
+		case s.op == "im":
+			v, _, err := a.eval(s.args[0], pos, true)
+			if err != nil {
+				return err
+			}
+			n := imSize(uint32(v))
+			for i := n; i < s.size; i++ {
+				sect.data = append(sect.data, opcodes["nop"])
+			}
+			for i := int(n) - 1; i >= 0; i-- {
+				sect.data = append(sect.data, 0x80|byte(int32(v)>>(7*i))&0x7F)
+			}
+		case dataSizes[s.op] > 0:
+			n := dataSizes[s.op]
+			for i := range s.args {
+				v, _, err := a.eval(s.args[i], pos, true)
+				if err != nil {
+					return err
+				}
+				if n < 4 && (v < -1<<(8*n-1) || v >= 1<<(8*n)) {
+					return &Error{s.line, fmt.Sprintf("%s: value %d out of range", s.op, v)}
+				}
+				for j := n - 1; j >= 0; j-- {
+					sect.data = append(sect.data, byte(v>>(8*j)))
+				}
+			}
+		default:
+			if o, ok := operandOps[s.op]; ok {
+				v := byte(s.val / o.scale)
+				if s.op == "storesp" || s.op == "loadsp" {
+					v ^= 0x10
+				}
+				sect.data = append(sect.data, o.op|v)
+			} else if op, ok := opcodes[s.op]; ok {
+				sect.data = append(sect.data, op)
+			}
+		}
+	}
+	for i := range a.sects {
+		s := &a.sects[i]
+		for mirv.Address(len(s.data)) < s.size {
+			s.data = append(s.data, 0)
+		}
+	}
+	return nil
+}
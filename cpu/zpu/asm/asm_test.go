@@ -0,0 +1,205 @@
+package asm_test
+
+import (
+	"bytes"
+	self "debug/elf"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/cpu/zpu/asm"
+	"github.com/db47h/mirv/elf"
+	"github.com/db47h/mirv/mem"
+)
+
+// TestTestdata checks that the test programs in ../testdata assemble to the
+// same code as the one generated by zpu-elf-gcc.
+func TestTestdata(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test files")
+	}
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := asm.Assemble(string(src))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		f, err := self.Open(strings.TrimSuffix(name, ".S") + ".elf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Entry != mirv.Address(f.Entry) {
+			t.Errorf("%s: expected entry %x, got %x", name, f.Entry, p.Entry)
+		}
+		img := p.Raw()
+		var end uint64
+		for _, ph := range f.Progs {
+			exp, err := io.ReadAll(ph.Open())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := ph.Paddr + ph.Filesz; e > uint64(len(img)) {
+				t.Errorf("%s: image too short: %x < %x", name, len(img), e)
+				continue
+			}
+			if got := img[ph.Paddr : ph.Paddr+ph.Filesz]; !bytes.Equal(got, exp) {
+				t.Errorf("%s: segment @ %x\nexpected % x\ngot      % x", name, ph.Paddr, exp, got)
+			}
+			if e := ph.Paddr + ph.Filesz; e > end {
+				end = e
+			}
+		}
+		if uint64(len(img)) != end {
+			t.Errorf("%s: expected image size %x, got %x", name, end, len(img))
+		}
+		f.Close()
+	}
+}
+
+func TestProgram_WriteELF(t *testing.T) {
+	p, err := asm.Assemble(`
+	im _data
+	load
+	breakpoint
+	.data
+	.balign 4
+_data:	.int 0x12345678, _data
+	.short -1
+	.byte 1, 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "test.elf")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.WriteELF(f); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var b mem.Bus
+	b.Map(0, mem.NewRAM(1<<12, mirv.BigEndian))
+	arch, entry, err := elf.Load(&b, name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arch.Machine != elf.MachineZPU || arch.Class != elf.Class32 || arch.Data != elf.DataBig {
+		t.Fatalf("Unexpected arch %v", arch)
+	}
+	if entry != 0 {
+		t.Fatalf("Expected entry 0, got %x", entry)
+	}
+	exp := []byte{
+		0x0B, 0x0B, 0x0B, 0x0B, 0x88, 0x08, 0x00, 0x00, // im _data, load, breakpoint
+		0x12, 0x34, 0x56, 0x78, 0x00, 0x00, 0x00, 0x08, 0xFF, 0xFF, 0x01, 0x02,
+	}
+	if img := p.Raw(); !bytes.Equal(img, exp) {
+		t.Fatalf("expected % x\ngot      % x", exp, img)
+	}
+	got := make([]byte, len(exp))
+	if _, err = b.CopyOut(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, exp) {
+		t.Fatalf("expected % x\ngot      % x", exp, got)
+	}
+}
+
+func TestAssemble_local(t *testing.T) {
+	p, err := asm.Assemble(`
+0:	im 0f
+	im 0b
+1:	nop
+0:	im 1b ; 0b is the label on this line
+	im 0b
+	.org 0x50
+	.int 0f
+	.balign 8, 0xFF
+0:`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{
+		0x0B, 0x0B, 0x0B, 0x0B, 0x8B, // 0: im 0f = 0x0B
+		0x0B, 0x0B, 0x0B, 0x0B, 0x80, // im 0b = 0
+		0x0B,                         // 1: nop
+		0x0B, 0x0B, 0x0B, 0x0B, 0x8A, // 0: im 1b = 0x0A
+		0x0B, 0x0B, 0x0B, 0x0B, 0x8B, // im 0b = 0x0B
+	}
+	exp = append(exp, make([]byte, 0x50-len(exp))...)
+	exp = append(exp, 0, 0, 0, 0x58, 0xFF, 0xFF, 0xFF, 0xFF)
+	if img := p.Raw(); !bytes.Equal(img, exp) {
+		t.Fatalf("expected % x\ngot      % x", exp, img)
+	}
+}
+
+func TestAssemble_operands(t *testing.T) {
+	p, err := asm.Assemble(`
+	im 63
+	im -64
+	im 64
+	im 0x7FFFFFFF
+	im -0x80000000
+	im 3 - 5 + 1
+	loadsp 0
+	storesp 124
+	addsp 60
+	emulate 1
+	loadh`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{
+		0xBF,
+		0xC0,
+		0x80, 0xC0,
+		0x87, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xF8, 0x80, 0x80, 0x80, 0x80,
+		0xFF,
+		0x70, 0x4F, 0x1F, 0x21, 0x22,
+	}
+	if img := p.Raw(); !bytes.Equal(img, exp) {
+		t.Fatalf("expected % x\ngot      % x", exp, img)
+	}
+}
+
+func TestAssemble_errors(t *testing.T) {
+	for _, d := range []struct {
+		src string
+		err string
+	}{
+		{"\n\tfoo", "line 2: unknown instruction or directive foo"},
+		{"\tim _foo", "line 1: undefined symbol _foo"},
+		{"\tim 0f", "line 1: undefined local label 0f"},
+		{"a:\na:", "line 2: symbol a already defined"},
+		{"\tloadsp 3", "line 1: loadsp: invalid operand 3"},
+		{"\taddsp 64", "line 1: addsp: invalid operand 64"},
+		{"\tnop 1", "line 1: nop: wrong number of operands"},
+		{"\tim", "line 1: im: wrong number of operands"},
+		{"\tim 1 +", "line 1: invalid expression \"1 +\""},
+		{"\t.org 4\n\t.org 2", "line 2: .org: cannot move location counter backwards"},
+		{"\t.balign 3", "line 1: .balign: alignment must be a power of 2"},
+		{"a:\t.org a", "line 1: .org: operand must be a constant"},
+		{"\t.byte 256", "line 1: .byte: value 256 out of range"},
+	} {
+		_, err := asm.Assemble(d.src)
+		if err == nil || err.Error() != d.err {
+			t.Errorf("%q: expected error %q, got %v", d.src, d.err, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package asm
+
+import (
+	self "debug/elf"
+	"encoding/binary"
+	"io"
+
+	"github.com/db47h/mirv/elf"
+)
+
+// WriteELF writes the program to w as a statically linked ZPU ELF executable
+// that can be loaded with elf.Load. Each section is stored in its own
+// loadable segment.
+//
+func (p *Program) WriteELF(w io.Writer) error {
+	const (
+		ehsize = 52 // sizeof(self.Header32)
+		phsize = 32 // sizeof(self.Prog32)
+	)
+	h := self.Header32{
+		Type:      uint16(self.ET_EXEC),
+		Machine:   uint16(elf.MachineZPU),
+		Version:   uint32(self.EV_CURRENT),
+		Entry:     uint32(p.Entry),
+		Phoff:     ehsize,
+		Ehsize:    ehsize,
+		Phentsize: phsize,
+		Phnum:     uint16(len(p.Sections)),
+	}
+	copy(h.Ident[:], self.ELFMAG)
+	h.Ident[self.EI_CLASS] = byte(self.ELFCLASS32)
+	h.Ident[self.EI_DATA] = byte(self.ELFDATA2MSB)
+	h.Ident[self.EI_VERSION] = byte(self.EV_CURRENT)
+	if err := binary.Write(w, binary.BigEndian, &h); err != nil {
+		return err
+	}
+
+	off := uint32(ehsize + phsize*len(p.Sections))
+	for i := range p.Sections {
+		s := &p.Sections[i]
+		flags := self.PF_R | self.PF_W
+		if s.Name == ".text" {
+			flags = self.PF_R | self.PF_X
+		}
+		ph := self.Prog32{
+			Type:   uint32(self.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    off,
+			Vaddr:  uint32(s.Addr),
+			Paddr:  uint32(s.Addr),
+			Filesz: uint32(len(s.Data)),
+			Memsz:  uint32(len(s.Data)),
+			Align:  uint32(s.Align),
+		}
+		if err := binary.Write(w, binary.BigEndian, &ph); err != nil {
+			return err
+		}
+		off += uint32(len(s.Data))
+	}
+	for i := range p.Sections {
+		if _, err := w.Write(p.Sections[i].Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
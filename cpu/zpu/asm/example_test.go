@@ -0,0 +1,37 @@
+package asm_test
+
+import (
+	"fmt"
+
+	"github.com/db47h/mirv/cpu/zpu"
+	"github.com/db47h/mirv/cpu/zpu/asm"
+	"github.com/db47h/mirv/mem"
+)
+
+func ExampleAssemble() {
+	p, err := asm.Assemble(`
+	.org 32
+_start:
+	im 0xDEADBEEF
+	flip
+	breakpoint`)
+	if err != nil {
+		panic(err)
+	}
+
+	var b mem.Bus
+	z := zpu.New(&b)
+	b.Map(0, mem.NewRAM(1<<16, z.ByteOrder()))
+	if err = p.Load(&b); err != nil {
+		panic(err)
+	}
+	z.Reset()
+	z.SetPC(p.Entry)
+	if _, err = z.Step(1000); err != nil {
+		panic(err)
+	}
+	tos, _ := b.Read32(z.SP())
+	fmt.Printf("%08X\n", tos)
+	// Output:
+	// F77DB57B
+}
@@ -0,0 +1,214 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package zpu
+
+import (
+	"bytes"
+
+	"github.com/db47h/mirv"
+)
+
+// The ZPU caches decoded basic blocks and the value at the top of the stack.
+//
+// Blocks are decoded from host memory (see mem.Bus.Slice) and keyed by their
+// start address. Consecutive IM instructions are merged into a single decoded
+// instruction. Blocks are also indexed by code page, i.e. by the pages of
+// 1<<pageShift bytes they span, so that writes by the ZPU only need to check
+// the blocks in the written pages, and invalidate those they overlap. Since the
+// Bus does not report writes by other bus masters without enabling access
+// hooks, a block is also checked against memory the first time execution
+// enters it in each call to Step.
+//
+// The top of stack cache is write-through: the value is always written to
+// memory, but reads come from the cache as long as SP does not change and
+// nothing else is written over it. It is invalidated every time Step is
+// called, so that changes made to memory between calls to Step are seen.
+//
+// Both caches are disabled when bus access hooks are enabled (see
+// mem.Bus.Hooked) or with Config.NoCache.
+
+// maxBlock is the maximum size in bytes of a decoded block.
+//
+const maxBlock = 64
+
+// pageShift is the log2 of the size of code pages.
+//
+const pageShift = 8
+
+// dop is a decoded instruction.
+//
+type dop struct {
+	op  opcode
+	n   uint8  // size in bytes, greater than 1 for merged IM instructions
+	imm uint32 // value pushed by merged IM instructions
+}
+
+type block struct {
+	pc   mirv.Address
+	end  mirv.Address
+	code []byte // code the block was decoded from
+	ops  []dop
+	gen  uint64 // call to Step in which code was last checked against memory
+}
+
+// decoded returns the decoded instruction at PC, or nil if it is not cached.
+// An IM instruction at the start of a decoded block always starts a new IM
+// sequence, so nil is also returned if it must continue the current one.
+//
+func (s *State) decoded() *dop {
+	if !s.fast {
+		return nil
+	}
+	if b := s.cur; b != nil && s.pc == s.next && s.ci < len(b.ops) {
+		d := &b.ops[s.ci]
+		s.ci++
+		s.next += mirv.Address(d.n)
+		return d
+	}
+	b := s.block(s.pc)
+	if s.cur = b; b == nil {
+		return nil
+	}
+	d := &b.ops[0]
+	if s.idim && d.op&opIMMask == opIM {
+		s.cur = nil
+		return nil
+	}
+	s.ci, s.next = 1, s.pc+mirv.Address(d.n)
+	return d
+}
+
+// block returns the block starting at address pc, or nil if pc is not in a
+// RAM block.
+//
+func (s *State) block(pc mirv.Address) *block {
+	base, m := s.b.Slice(pc)
+	if m == nil {
+		return nil
+	}
+	code := m[pc-base:]
+	if b := s.blocks[pc]; b != nil {
+		if b.gen == s.gen {
+			return b
+		}
+		if bytes.HasPrefix(code, b.code) {
+			b.gen = s.gen
+			return b
+		}
+		s.drop(b)
+	}
+	if len(code) > maxBlock {
+		code = code[:maxBlock]
+	}
+	b := &block{pc: pc, gen: s.gen}
+	i := 0
+	for i < len(code) {
+		d := dop{op: opcode(code[i]), n: 1}
+		i++
+		if d.op&opIMMask == opIM {
+			d.imm = uint32(int32(d.op) << 25 >> 25)
+			for ; i < len(code) && code[i]&0x80 != 0; i++ {
+				d.imm = d.imm<<7 | uint32(code[i]&0x7F)
+				d.n++
+			}
+		}
+		b.ops = append(b.ops, d)
+		if s.ends(d.op) {
+			break
+		}
+	}
+	b.code = append([]byte(nil), code[:i]...)
+	b.end = pc + mirv.Address(i)
+	if s.blocks == nil {
+		s.blocks = make(map[mirv.Address]*block)
+		s.pages = make(map[mirv.Address][]*block)
+	}
+	s.blocks[pc] = b
+	for p := pc >> pageShift; p <= (b.end-1)>>pageShift; p++ {
+		s.pages[p] = append(s.pages[p], b)
+	}
+	if len(s.blocks) == 1 || pc < s.lo {
+		s.lo = pc
+	}
+	if b.end > s.hi {
+		s.hi = b.end
+	}
+	return b
+}
+
+// drop removes block b from the cache.
+//
+func (s *State) drop(b *block) {
+	delete(s.blocks, b.pc)
+	for p := b.pc >> pageShift; p <= (b.end-1)>>pageShift; p++ {
+		bs := s.pages[p]
+		for i := range bs {
+			if bs[i] == b {
+				bs = append(bs[:i], bs[i+1:]...)
+				break
+			}
+		}
+		if len(bs) == 0 {
+			delete(s.pages, p)
+		} else {
+			s.pages[p] = bs
+		}
+	}
+	if s.cur == b {
+		s.cur = nil
+	}
+	if len(s.blocks) == 0 {
+		s.lo, s.hi = 0, 0
+	}
+}
+
+// ends returns true if op ends a block, i.e. if it can change PC to anything
+// else than the address of the next instruction.
+//
+func (s *State) ends(op opcode) bool {
+	switch op {
+	case opBreakPoint, opPopPC, opCall, opCallPCRel, opPopPCRel, opEqBranch, opNeqBranch, opSyscall:
+		return true
+	}
+	return op&opEmulateMask == opEmulate && s.hw&(1<<(op-opEmulate)) == 0
+}
+
+// written invalidates the caches after a write of n bytes at address addr.
+//
+func (s *State) written(addr, n mirv.Address) {
+	if addr < s.sp+4 && addr+n > s.sp {
+		s.topOK = false
+	}
+	if n == 0 || addr >= s.hi || addr+n <= s.lo {
+		return
+	}
+	for p := addr >> pageShift; p <= (addr+n-1)>>pageShift; p++ {
+		bs := s.pages[p]
+		for i := 0; i < len(bs); {
+			if b := bs[i]; addr < b.end && addr+n > b.pc {
+				s.drop(b)
+				bs = s.pages[p]
+				continue
+			}
+			i++
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package zpu
+
+import (
+	"fmt"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/cpu"
+	"github.com/db47h/mirv/mem"
+)
+
+// Variant is a ZPU core variant. Variants differ by the instructions of the
+// emulate group (opcodes 32 to 63) that they implement in hardware. The
+// others trap to their emulation routine at address (opcode-32)*32.
+//
+// Except for Full, the instruction sets are approximations of the default
+// configuration of the corresponding cores. Use Config.Hardware for an exact
+// match with a custom core configuration.
+//
+type Variant uint8
+
+// Variant values.
+//
+const (
+	Full      Variant = iota // all instructions except config in hardware
+	Small                    // zpu4 small: no emulate group instruction in hardware
+	Medium                   // zpu4 medium
+	Avalanche                // Avalanche
+	Flex                     // ZPUFlex
+)
+
+func hw(ops ...opcode) uint32 {
+	var m uint32
+	for _, op := range ops {
+		m |= 1 << (op - opEmulate)
+	}
+	return m
+}
+
+var (
+	hwMedium = hw(opLoadB, opStoreB, opLoadH, opStoreH, opLessThan, opLessThanOrEqual, opULessThan,
+		opULessThanOrEqual, opMult, opLShiftRight, opAShiftLeft, opAShiftRight, opCall, opEq, opNeq, opNeg,
+		opSub, opXor, opEqBranch, opNeqBranch, opPopPCRel, opPushSPAdd, opCallPCRel)
+	hwFlex = hw(opMult, opLessThan, opLessThanOrEqual, opULessThan, opULessThanOrEqual, opSub, opEq, opNeq,
+		opEqBranch, opNeqBranch, opCall, opCallPCRel, opLShiftRight, opAShiftLeft, opAShiftRight, opXor)
+	// config traps so that the crt0 emulation routine can set the newlib
+	// _hardware flag, telling it to use the board's devices instead of
+	// syscalls. Add "config" to Config.Hardware for programs that expect the
+	// ZPU simulator instead. Opcodes 32 and 33 are not instructions.
+	hwFull      = ^hw(32, 33, opConfig)
+	hwAvalanche = hwFull &^ hw(opDiv, opMod, opSyscall)
+)
+
+var variantHW = [...]uint32{
+	Full:      hwFull,
+	Small:     0,
+	Medium:    hwMedium,
+	Avalanche: hwAvalanche,
+	Flex:      hwFlex,
+}
+
+// Config is the configuration of a ZPU core.
+//
+type Config struct {
+	Variant Variant
+
+	// Hardware, if not nil, overrides the set of emulate group instructions
+	// implemented in hardware. Instructions are specified by their mnemonic,
+	// like "loadb" or "eqbranch".
+	//
+	// In hardware, config pops the CPU type and leaves the newlib _hardware
+	// flag cleared: newlib programs then use the devices of the ZPU simulator
+	// and system calls to Host instead of the board's devices.
+	Hardware []string
+
+	ResetPC     mirv.Address // value of PC after Reset
+	StackTop    mirv.Address // value of SP after Reset; if 0, the end of the highest mapped RAM block
+	NoInterrupt bool         // the core has no interrupt input, see State.Interrupt
+	NoCache     bool         // disable the decoded instruction and top of stack caches
+	Misaligned  bool         // do not ignore the low address bits of load, store, loadh and storeh, see State
+
+	// Host is the host I/O backend used for system calls. If nil, guest
+	// programs only have access to the standard I/O of the host process (see
+	// cpu.NewStdioHost). Use cpu.NewOSHost to give them access to the host's
+	// file system.
+	Host cpu.Host
+}
+
+// NewWithConfig instantiates a new ZPU with the given configuration and
+// returns its interface.
+//
+func NewWithConfig(b *mem.Bus, cfg Config) (cpu.Interface, error) {
+	if int(cfg.Variant) >= len(variantHW) {
+		return nil, fmt.Errorf("unknown ZPU variant %d", cfg.Variant)
+	}
+	s := &State{
+		b:    b,
+		host: cfg.Host,
+		cfg:  cfg,
+		hw:   variantHW[cfg.Variant],
+		m32:  ^uint32(3),
+		m16:  ^uint32(1),
+	}
+	if cfg.Misaligned {
+		s.m32, s.m16 = ^uint32(0), ^uint32(0)
+	}
+	if s.host == nil {
+		s.host = cpu.NewStdioHost()
+	}
+	if cfg.Hardware != nil {
+		s.hw = 0
+	next:
+		for _, n := range cfg.Hardware {
+			for i, en := range emulNames {
+				if en == n {
+					s.hw |= 1 << i
+					continue next
+				}
+			}
+			return nil, fmt.Errorf("no such hardware instruction %q", n)
+		}
+	}
+	return s, nil
+}
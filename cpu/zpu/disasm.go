@@ -0,0 +1,149 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package zpu
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/mem"
+)
+
+var opNames = [16]string{
+	opBreakPoint: "breakpoint",
+	opPushSP:     "pushsp",
+	opPopPC:      "poppc",
+	opAdd:        "add",
+	opAnd:        "and",
+	opOr:         "or",
+	opLoad:       "load",
+	opNot:        "not",
+	opFlip:       "flip",
+	opNop:        "nop",
+	opStore:      "store",
+	opPopSP:      "popsp",
+}
+
+var emulNames = [...]string{
+	opLoadH - opEmulate:            "loadh",
+	opStoreH - opEmulate:           "storeh",
+	opLessThan - opEmulate:         "lessthan",
+	opLessThanOrEqual - opEmulate:  "lessthanorequal",
+	opULessThan - opEmulate:        "ulessthan",
+	opULessThanOrEqual - opEmulate: "ulessthanorequal",
+	opSwap - opEmulate:             "swap",
+	opMult - opEmulate:             "mult",
+	opLShiftRight - opEmulate:      "lshiftright",
+	opAShiftLeft - opEmulate:       "ashiftleft",
+	opAShiftRight - opEmulate:      "ashiftright",
+	opCall - opEmulate:             "call",
+	opEq - opEmulate:               "eq",
+	opNeq - opEmulate:              "neq",
+	opNeg - opEmulate:              "neg",
+	opSub - opEmulate:              "sub",
+	opXor - opEmulate:              "xor",
+	opLoadB - opEmulate:            "loadb",
+	opStoreB - opEmulate:           "storeb",
+	opDiv - opEmulate:              "div",
+	opMod - opEmulate:              "mod",
+	opEqBranch - opEmulate:         "eqbranch",
+	opNeqBranch - opEmulate:        "neqbranch",
+	opPopPCRel - opEmulate:         "poppcrel",
+	opConfig - opEmulate:           "config",
+	opPushPC - opEmulate:           "pushpc",
+	opSyscall - opEmulate:          "syscall",
+	opPushSPAdd - opEmulate:        "pushspadd",
+	opMult16x16 - opEmulate:        "mult16x16",
+	opCallPCRel - opEmulate:        "callpcrel",
+}
+
+// Disassembler decodes ZPU instructions. It keeps track of IM sequences in
+// order to show the accumulated value of multi-byte immediates. The zero value
+// is ready to use.
+//
+type Disassembler struct {
+	idim bool
+	imm  uint32
+}
+
+// Reset makes the next IM instruction start a new IM sequence.
+//
+func (d *Disassembler) Reset() {
+	d.idim = false
+}
+
+// Decode returns the zpu-elf-objdump style text of the instruction insn.
+// Immediates are shown as the 7 bits value of the instruction followed by the
+// value accumulated so far by the IM sequence:
+//
+//	im 42 (0x2a)
+//	im 8 (0x1508)
+//
+func (d *Disassembler) Decode(insn byte) string {
+	op := opcode(insn)
+	if op&opIMMask == opIM {
+		v := int32(insn) << 25 >> 25
+		if d.idim {
+			v = int32(insn & 0x7F)
+			d.imm = d.imm<<7 | uint32(v)
+		} else {
+			d.imm = uint32(v)
+			d.idim = true
+		}
+		return fmt.Sprintf("im %d (%#x)", v, d.imm)
+	}
+	d.idim = false
+	switch {
+	case op&opStoreSPMask == opStoreSP:
+		return fmt.Sprintf("storesp %d", ((insn&0x1F)^0x10)*4)
+	case op&opLoadSPMask == opLoadSP:
+		return fmt.Sprintf("loadsp %d", ((insn&0x1F)^0x10)*4)
+	case op&opEmulateMask == opEmulate:
+		if n := emulNames[op-opEmulate]; n != "" {
+			return n
+		}
+		return fmt.Sprintf("emulate %d", op-opEmulate)
+	case op&opAddSPMask == opAddSP:
+		return fmt.Sprintf("addsp %d", (insn&0x0F)*4)
+	}
+	if n := opNames[op]; n != "" {
+		return n
+	}
+	return "(bad)"
+}
+
+// Disassemble writes a zpu-elf-objdump style listing of the code in the
+// address range [start, end) to w.
+//
+func Disassemble(w io.Writer, b *mem.Bus, start, end mirv.Address) error {
+	var d Disassembler
+	for addr := start; addr < end; addr++ {
+		insn, err := b.Read8(addr)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "%8x:\t%02x\t%s\n", addr, insn, d.Decode(insn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
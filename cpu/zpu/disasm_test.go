@@ -0,0 +1,72 @@
+package zpu_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/cpu/zpu"
+	"github.com/db47h/mirv/mem"
+)
+
+// listing returns the disassembly of p loaded at address org.
+func listing(p []byte) string {
+	var (
+		b  mem.Bus
+		sb strings.Builder
+	)
+	b.Map(0, mem.NewRAM(top, zpu.New(&b).ByteOrder()))
+	b.CopyIn(org, p)
+	if err := zpu.Disassemble(&sb, &b, org, org+mirv.Address(len(p))); err != nil {
+		return err.Error()
+	}
+	return sb.String()
+}
+
+func TestDisassembler_Decode(t *testing.T) {
+	var d zpu.Disassembler
+	for _, c := range []struct {
+		insn byte
+		s    string
+	}{
+		{0x00, "breakpoint"},
+		{0x01, "(bad)"},
+		{0x0B, "nop"},
+		{0x0D, "popsp"},
+		{0x10, "addsp 0"},
+		{0x1F, "addsp 60"},
+		{0x20, "emulate 0"},
+		{0x22, "loadh"},
+		{0x37, "eqbranch"},
+		{0x3F, "callpcrel"},
+		{0x40, "storesp 64"},
+		{0x50, "storesp 0"},
+		{0x51, "storesp 4"},
+		{0x6F, "loadsp 124"},
+		{0x71, "loadsp 4"},
+		{0xFF, "im -1 (0xffffffff)"},
+		{0x0B, "nop"},
+		{0xAA, "im 42 (0x2a)"},
+		{0x88, "im 8 (0x1508)"},
+		{0xFF, "im 127 (0xa847f)"},
+	} {
+		if s := d.Decode(c.insn); s != c.s {
+			t.Errorf("%02x: expected %q, got %q", c.insn, c.s, s)
+		}
+	}
+	d.Reset()
+	if s := d.Decode(0x88); s != "im 8 (0x8)" {
+		t.Errorf("Expected new IM sequence after Reset, got %q", s)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	const exp = "" +
+		"      80:\t99\tim 25 (0x19)\n" +
+		"      81:\te0\tim 96 (0xce0)\n" +
+		"      82:\t04\tpoppc\n" +
+		"      83:\t3c\tsyscall\n"
+	if s := listing([]byte{0x99, 0xE0, 0x04, 0x3C}); s != exp {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", exp, s)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package zpu
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/cpu"
+	"github.com/db47h/mirv/mem"
+)
+
+// memReg is the address of the R0 pseudo register, as laid out by the zpu-elf
+// crt0. System calls return their result in R0.
+//
+const memReg = 0x30
+
+// System call numbers of the zpu-elf newlib port.
+//
+const (
+	sysExit         = 1
+	sysOpen         = 2
+	sysClose        = 3
+	sysRead         = 4
+	sysWrite        = 5
+	sysLseek        = 6
+	sysFstat        = 10
+	sysGettimeofday = 19
+	sysIsatty       = 3001
+)
+
+// newlib errno values.
+//
+const (
+	eNOENT = 2
+	eIO    = 5
+	eBADF  = 9
+	eACCES = 13
+	eFAULT = 14
+	eEXIST = 17
+	eINVAL = 22
+	eNOTTY = 25
+	eNOSYS = 88
+)
+
+// newlib open flags.
+//
+const (
+	oACCMODE = 0x0003
+	oAPPEND  = 0x0008
+	oCREAT   = 0x0200
+	oTRUNC   = 0x0400
+	oEXCL    = 0x0800
+)
+
+// maxIO is the maximum number of bytes transferred by a single read or write
+// system call. Guest programs must handle short reads and writes anyway.
+//
+const maxIO = 1 << 16
+
+// SetHost sets the host I/O backend used for system calls. The default
+// backend is connected to the standard I/O of the host process and does not
+// give access to the host's file system (see Config.Host):
+//
+//	z.SetHost(cpu.NewOSHost()) // allow guest programs to open host files
+//
+func (s *State) SetHost(h cpu.Host) {
+	s.host = h
+}
+
+// Exited returns the exit code passed by the guest program to the exit system
+// call. ok is false if the program did not call exit since the last Reset.
+//
+func (s *State) Exited() (code int, ok bool) {
+	return s.stop.Code, s.stop.Reason == cpu.StopExit
+}
+
+// syscall implements the newlib system calls. The zpu-elf libgloss calls
+// them through:
+//
+//	int _syscall(int *errno, int id, ...);
+//
+// which executes the syscall instruction followed by poppc. On entry, the
+// stack holds the return address, the pointer to errno, the system call number
+// and its arguments. The result is returned in R0.
+//
+func (s *State) syscall() {
+	arg := func(i mirv.Address) uint32 { return s.read32(s.sp + 12 + i*4) }
+	var (
+		ret   int32
+		errno uint32
+		err   error
+	)
+	switch s.read32(s.sp + 8) {
+	case sysExit:
+		s.stop = cpu.StopInfo{Reason: cpu.StopExit, Code: int(int32(arg(0)))}
+		s.halted = true
+	case sysOpen:
+		// path, strlen(path)+1, flags, mode
+		var name []byte
+		if n := arg(1); n > 0 {
+			name, err = s.copyOut(arg(0), n-1)
+		}
+		if err == nil {
+			var fd int
+			fd, err = s.host.Open(string(name), openFlags(arg(2)), fs.FileMode(arg(3)&0777))
+			ret = int32(fd)
+		}
+	case sysClose:
+		err = s.host.Close(int(int32(arg(0))))
+	case sysRead:
+		var p []byte
+		if p, err = s.buffer(arg(2)); err == nil {
+			var n int
+			n, err = s.host.Read(int(int32(arg(0))), p)
+			if err == io.EOF {
+				err = nil
+			}
+			if n > 0 {
+				s.written(mirv.Address(arg(1)), mirv.Address(n))
+				if _, e := s.b.CopyIn(mirv.Address(arg(1)), p[:n]); e != nil {
+					err = e
+				}
+			}
+			ret = int32(n)
+		}
+	case sysWrite:
+		var p []byte
+		if p, err = s.copyOut(arg(1), arg(2)); err == nil {
+			var n int
+			n, err = s.host.Write(int(int32(arg(0))), p)
+			ret = int32(n)
+		}
+	case sysLseek:
+		var off int64
+		off, err = s.host.Seek(int(int32(arg(0))), int64(int32(arg(1))), int(arg(2)))
+		ret = int32(off)
+	case sysFstat:
+		var fi fs.FileInfo
+		if fi, err = s.host.Stat(int(int32(arg(0)))); err == nil {
+			err = s.writeStat(arg(1), fi)
+		}
+	case sysGettimeofday:
+		if tv := arg(0); tv != 0 {
+			t := s.host.Now()
+			s.write32(mirv.Address(tv), uint32(t.Unix()))
+			s.write32(mirv.Address(tv)+4, uint32(t.Nanosecond()/1000))
+		}
+	case sysIsatty:
+		var fi fs.FileInfo
+		if fi, err = s.host.Stat(int(int32(arg(0)))); err == nil {
+			if fi.Mode()&fs.ModeCharDevice != 0 {
+				ret = 1
+			} else {
+				errno = eNOTTY
+			}
+		}
+	default:
+		ret, errno = -1, eNOSYS
+	}
+	if err != nil {
+		ret, errno = -1, errnoOf(err)
+	}
+	if p := s.read32(s.sp + 4); p != 0 {
+		s.write32(mirv.Address(p), errno)
+	}
+	s.write32(memReg, uint32(ret))
+}
+
+// buffer returns a host buffer of n bytes, at most maxIO.
+//
+func (s *State) buffer(n uint32) ([]byte, error) {
+	if int32(n) < 0 {
+		return nil, fs.ErrInvalid
+	}
+	if n > maxIO {
+		n = maxIO
+	}
+	return make([]byte, n), nil
+}
+
+// copyOut returns a copy of n bytes of guest memory at addr, at most maxIO.
+//
+func (s *State) copyOut(addr uint32, n uint32) ([]byte, error) {
+	p, err := s.buffer(n)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.b.CopyOut(p, mirv.Address(addr)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// writeStat writes fi as a newlib struct stat at address addr.
+//
+func (s *State) writeStat(addr uint32, fi fs.FileInfo) error {
+	const (
+		sIFCHR = 0020000
+		sIFDIR = 0040000
+		sIFREG = 0100000
+	)
+	var st [60]byte
+	m := fi.Mode()
+	mode := uint32(m.Perm())
+	switch {
+	case m&fs.ModeCharDevice != 0:
+		mode |= sIFCHR
+	case m.IsDir():
+		mode |= sIFDIR
+	case m.IsRegular():
+		mode |= sIFREG
+	}
+	binary.BigEndian.PutUint32(st[4:], mode)                         // st_mode
+	binary.BigEndian.PutUint32(st[16:], uint32(fi.Size()))           // st_size
+	binary.BigEndian.PutUint32(st[28:], uint32(fi.ModTime().Unix())) // st_mtime
+	binary.BigEndian.PutUint32(st[44:], 512)                         // st_blksize
+	s.written(mirv.Address(addr), mirv.Address(len(st)))
+	_, err := s.b.CopyIn(mirv.Address(addr), st[:])
+	return err
+}
+
+// openFlags converts newlib open flags to os flags.
+//
+func openFlags(f uint32) int {
+	var flags int
+	switch f & oACCMODE {
+	case 1:
+		flags = os.O_WRONLY
+	case 2:
+		flags = os.O_RDWR
+	default:
+		flags = os.O_RDONLY
+	}
+	if f&oAPPEND != 0 {
+		flags |= os.O_APPEND
+	}
+	if f&oCREAT != 0 {
+		flags |= os.O_CREATE
+	}
+	if f&oTRUNC != 0 {
+		flags |= os.O_TRUNC
+	}
+	if f&oEXCL != 0 {
+		flags |= os.O_EXCL
+	}
+	return flags
+}
+
+// errnoOf converts err to a newlib errno value.
+//
+func errnoOf(err error) uint32 {
+	var be *mem.ErrBus
+	switch {
+	case errors.As(err, &be):
+		return eFAULT
+	case errors.Is(err, cpu.ErrBadFD), errors.Is(err, fs.ErrClosed):
+		return eBADF
+	case errors.Is(err, fs.ErrNotExist):
+		return eNOENT
+	case errors.Is(err, fs.ErrExist):
+		return eEXIST
+	case errors.Is(err, fs.ErrPermission):
+		return eACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return eINVAL
+	}
+	return eIO
+}
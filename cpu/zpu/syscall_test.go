@@ -0,0 +1,242 @@
+package zpu_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/cpu"
+	"github.com/db47h/mirv/cpu/zpu"
+	"github.com/db47h/mirv/elf"
+	"github.com/db47h/mirv/mem"
+)
+
+type fixedTime struct {
+	*cpu.OSHost
+}
+
+func (fixedTime) Now() time.Time { return time.Unix(1500000000, 123456000) }
+
+const (
+	memReg = 0x30
+	errno  = 0x200
+	buf    = 0x400
+	org    = 0x80
+)
+
+// sys executes the syscall instruction like the zpu-elf _syscall function and
+// returns R0 and errno.
+func sys(z *zpu.State, b *mem.Bus, id int32, args ...int32) (int32, uint32) {
+	var p []byte
+	for i := len(args) - 1; i >= 0; i-- {
+		p = append(p, im(args[i])...)
+		p = append(p, 0x0B)
+	}
+	p = append(p, prog(im(id), 0x0B, im(errno), 0x0B, im(0), 60, 0)...)
+	b.CopyIn(org, p)
+	b.Write32(errno, 0xFFFFFFFF)
+	z.SetPC(org)
+	z.Step(1000)
+	r, _ := b.Read32(memReg)
+	e, _ := b.Read32(errno)
+	return int32(r), e
+}
+
+func newSys() (*zpu.State, *mem.Bus, *cpu.OSHost) {
+	var b mem.Bus
+	z := zpu.New(&b).(*zpu.State)
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	h := &cpu.OSHost{}
+	z.SetHost(fixedTime{h})
+	z.Reset()
+	return z, &b, h
+}
+
+func TestSyscall_stdio(t *testing.T) {
+	z, b, h := newSys()
+	var out bytes.Buffer
+	h.Stdin, h.Stdout = strings.NewReader("abc"), &out
+	b.CopyIn(buf, []byte("Hello"))
+	if r, e := sys(z, b, 5, 1, buf, 5); r != 5 || e != 0 || out.String() != "Hello" {
+		t.Fatalf("write: got %d, errno %d, output %q", r, e, out.String())
+	}
+	if r, e := sys(z, b, 4, 0, buf, 10); r != 3 || e != 0 {
+		t.Fatalf("read: got %d, errno %d", r, e)
+	}
+	p := make([]byte, 5)
+	if b.CopyOut(p, buf); string(p) != "abclo" {
+		t.Fatalf("read: expected \"abclo\", got %q", p)
+	}
+	if r, e := sys(z, b, 4, 0, buf, 10); r != 0 || e != 0 {
+		t.Fatalf("read at EOF: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 5, 2, buf, 5); r != -1 || e != 9 {
+		t.Fatalf("write to unconnected stderr: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 3001, 1); r != 1 || e != 0 {
+		t.Fatalf("isatty: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 10, 1, buf); r != 0 || e != 0 {
+		t.Fatalf("fstat: got %d, errno %d", r, e)
+	}
+	if mode, _ := b.Read32(buf + 4); mode&0170000 != 0020000 {
+		t.Fatalf("fstat: expected character device, got mode %o", mode)
+	}
+	if r, e := sys(z, b, 19, buf, 0); r != 0 || e != 0 {
+		t.Fatalf("gettimeofday: got %d, errno %d", r, e)
+	}
+	sec, _ := b.Read32(buf)
+	usec, _ := b.Read32(buf + 4)
+	if sec != 1500000000 || usec != 123456 {
+		t.Fatalf("gettimeofday: got %d.%06d", sec, usec)
+	}
+	if r, e := sys(z, b, 1000); r != -1 || e != 88 {
+		t.Fatalf("unknown syscall: got %d, errno %d", r, e)
+	}
+}
+
+func TestSyscall_file(t *testing.T) {
+	z, b, _ := newSys()
+	name := filepath.Join(t.TempDir(), "test.txt")
+	const path = buf + 0x400
+	b.CopyIn(path, append([]byte(name), 0))
+	if r, e := sys(z, b, 2, path, int32(len(name)+1), 0, 0); r != -1 || e != 2 {
+		t.Fatalf("open non-existing file: got %d, errno %d", r, e)
+	}
+	fd, e := sys(z, b, 2, path, int32(len(name)+1), 0x0202, 0644) // O_RDWR|O_CREAT
+	if fd != 3 || e != 0 {
+		t.Fatalf("open: got %d, errno %d", fd, e)
+	}
+	b.CopyIn(buf, []byte("0123456789"))
+	if r, e := sys(z, b, 5, fd, buf, 10); r != 10 || e != 0 {
+		t.Fatalf("write: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 6, fd, -4, 2); r != 6 || e != 0 {
+		t.Fatalf("lseek: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 4, fd, buf+16, 10); r != 4 || e != 0 {
+		t.Fatalf("read: got %d, errno %d", r, e)
+	}
+	p := make([]byte, 4)
+	if b.CopyOut(p, buf+16); string(p) != "6789" {
+		t.Fatalf("read: expected \"6789\", got %q", p)
+	}
+	if r, e := sys(z, b, 10, fd, buf); r != 0 || e != 0 {
+		t.Fatalf("fstat: got %d, errno %d", r, e)
+	}
+	if size, _ := b.Read32(buf + 16); size != 10 {
+		t.Fatalf("fstat: expected size 10, got %d", size)
+	}
+	if r, e := sys(z, b, 3001, fd); r != 0 || e != 25 {
+		t.Fatalf("isatty: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 3, fd); r != 0 || e != 0 {
+		t.Fatalf("close: got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, b, 3, fd); r != -1 || e != 9 {
+		t.Fatalf("close: got %d, errno %d", r, e)
+	}
+	if data, err := os.ReadFile(name); err != nil || string(data) != "0123456789" {
+		t.Fatalf("file contents: %q, %v", data, err)
+	}
+}
+
+// TestSyscall_defaultHost checks that the default host does not give access
+// to the host's file system.
+func TestSyscall_defaultHost(t *testing.T) {
+	var b mem.Bus
+	z := zpu.New(&b).(*zpu.State)
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	z.Reset()
+	name := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(name, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const path = buf + 0x400
+	b.CopyIn(path, append([]byte(name), 0))
+	if r, e := sys(z, &b, 2, path, int32(len(name)+1), 0, 0); r != -1 || e != 13 {
+		t.Fatalf("open: expected EACCES, got %d, errno %d", r, e)
+	}
+	if r, e := sys(z, &b, 2, path, int32(len(name)+1), 0x0602, 0644); r != -1 || e != 13 { // O_RDWR|O_CREAT|O_TRUNC
+		t.Fatalf("open for writing: expected EACCES, got %d, errno %d", r, e)
+	}
+	if data, err := os.ReadFile(name); err != nil || string(data) != "secret" {
+		t.Fatalf("file contents: %q, %v", data, err)
+	}
+}
+
+// TestSyscall_config runs programs with config in hardware. In this case, the
+// crt0 of hello.elf leaves the newlib _hardware flag cleared and uses the UART
+// of the ZPU simulator, and libgloss I/O goes through system calls.
+func TestSyscall_config(t *testing.T) {
+	var b mem.Bus
+	var out bytes.Buffer
+	z, err := zpu.NewWithConfig(&b, zpu.Config{
+		Hardware: []string{"config", "syscall"},
+		Host:     &cpu.StdioHost{OSHost: cpu.OSHost{Stdout: &out}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Map(0, mem.NewRAM(1<<16, z.ByteOrder()))
+	sim := uart{txReady: 1}
+	b.Map(0x80000024-0xC, &sim)
+	_, entry, err := elf.Load(&b, "testdata/hello.elf", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.Reset()
+	z.SetPC(entry)
+	if _, err = z.Step(2000000); err != nil {
+		t.Fatal(err)
+	}
+	if string(sim.buf) != "Hello, World!" {
+		t.Fatalf("Expected \"Hello, World!\", got %q", sim.buf)
+	}
+
+	s := z.(*zpu.State)
+	s.Reset()
+	b.CopyIn(org, prog(im(2), 58, 0))
+	s.SetPC(org)
+	if _, err = s.Step(100); err != nil {
+		t.Fatal(err)
+	}
+	if s.PC() != org+2 || s.SP() != 1<<16 {
+		t.Fatalf("config: expected PC %08X and SP %08X, got %08X and %08X", org+2, 1<<16, s.PC(), s.SP())
+	}
+	b.CopyIn(buf, []byte("Hello, World!"))
+	if r, e := sys(s, &b, 5, 1, buf, 13); r != 13 || e != 0 {
+		t.Fatalf("write: expected 13, got %d, errno %d", r, e)
+	}
+	sys(s, &b, 1, 0)
+	if out.String() != "Hello, World!" {
+		t.Fatalf("Expected \"Hello, World!\" on stdout, got %q", out.String())
+	}
+	if code, ok := s.Exited(); code != 0 || !ok {
+		t.Fatalf("Expected exit code 0, got %d, %v", code, ok)
+	}
+}
+
+func TestSyscall_exit(t *testing.T) {
+	z, b, _ := newSys()
+	if _, ok := z.Exited(); ok {
+		t.Fatal("Exited returned true after Reset")
+	}
+	sys(z, b, 1, 3)
+	if code, ok := z.Exited(); code != 3 || !ok {
+		t.Fatalf("Expected exit code 3, got %d, %v", code, ok)
+	}
+	if st := z.Stopped(); st.Reason != cpu.StopExit || st.Code != 3 {
+		t.Fatalf("Unexpected stop reason %v", st)
+	}
+	if c, _ := z.Step(1000); c != 0 {
+		t.Fatalf("Step after exit executed %d cycles", c)
+	}
+	if pc := z.PC(); pc != mirv.Address(org+len(prog(im(3), 0x0B, im(1), 0x0B, im(errno), 0x0B, im(0), 60))) {
+		t.Fatalf("Unexpected PC after exit: %08X", pc)
+	}
+}
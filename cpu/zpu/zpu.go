@@ -23,6 +23,9 @@
 package zpu
 
 import (
+	"errors"
+	"sync/atomic"
+
 	"github.com/db47h/mirv"
 	"github.com/db47h/mirv/cpu"
 	"github.com/db47h/mirv/mem"
@@ -49,8 +52,37 @@ const (
 	opFlip       opcode = 0x0A
 	opNop        opcode = 0x0B
 
-	opSwap    opcode = 40
-	opSyscall opcode = 60
+	// emulated instructions
+	opLoadH            opcode = 34
+	opStoreH           opcode = 35
+	opLessThan         opcode = 36
+	opLessThanOrEqual  opcode = 37
+	opULessThan        opcode = 38
+	opULessThanOrEqual opcode = 39
+	opSwap             opcode = 40
+	opMult             opcode = 41
+	opLShiftRight      opcode = 42
+	opAShiftLeft       opcode = 43
+	opAShiftRight      opcode = 44
+	opCall             opcode = 45
+	opEq               opcode = 46
+	opNeq              opcode = 47
+	opNeg              opcode = 48
+	opSub              opcode = 49
+	opXor              opcode = 50
+	opLoadB            opcode = 51
+	opStoreB           opcode = 52
+	opDiv              opcode = 53
+	opMod              opcode = 54
+	opEqBranch         opcode = 55
+	opNeqBranch        opcode = 56
+	opPopPCRel         opcode = 57
+	opConfig           opcode = 58
+	opPushPC           opcode = 59
+	opSyscall          opcode = 60
+	opPushSPAdd        opcode = 61
+	opMult16x16        opcode = 62
+	opCallPCRel        opcode = 63
 )
 
 const (
@@ -61,40 +93,79 @@ const (
 	opEmulateMask opcode = 0xE0
 )
 
+// irqVector is the address of the interrupt handler.
+//
+const irqVector = 0x20
+
+var errDivide = errors.New("integer divide by zero")
+
 // State holds the state for a ZPU instance
 //
+// Like the zpu4 hardware, load, store, loadh and storeh ignore the low bits of
+// the address that make it misaligned. With Config.Misaligned, the address is
+// passed as-is to the bus: misaligned accesses follow the alignment policy of
+// the bus (see mem.Bus.SetAlignment) and fault with cpu.FaultMisaligned when
+// trapped.
+//
 type State struct {
 	b      *mem.Bus
 	pc     mirv.Address
 	sp     mirv.Address
 	idim   bool
 	halted bool
+	irq    bool // interrupt line
+	inIRQ  bool // interrupt being serviced, cleared by poppc
+	host   cpu.Host
+	stop   cpu.StopInfo
+	req    atomic.Bool // stop requested
+	cfg    Config
+	hw     uint32 // emulate group instructions implemented in hardware
+	m32    uint32 // address mask for load and store
+	m16    uint32 // address mask for loadh and storeh
+
+	// caches, see cache.go
+	fast   bool // caches enabled
+	top    uint32
+	topOK  bool
+	blocks map[mirv.Address]*block
+	pages  map[mirv.Address][]*block // blocks in each code page
+	lo, hi mirv.Address              // address range of cached blocks
+	gen    uint64                    // number of calls to Step
+	cur    *block                    // current block
+	ci     int                       // index of the next instruction in cur
+	next   mirv.Address              // address of the next instruction in cur
 }
 
-// New instantiates a new ZPU and returns its interface.
+// New instantiates a new ZPU with the Full variant and the default
+// configuration, and returns its interface.
 //
 func New(b *mem.Bus) cpu.Interface {
-	z := State{
-		b: b,
-	}
-	return &z
+	z, _ := NewWithConfig(b, Config{})
+	return z
 }
 
 // ByteOrder returns mirv.BigEndian
 //
 func (*State) ByteOrder() mirv.ByteOrder { return mirv.BigEndian }
 
-// Reset resets the ZPU to a known initial state.
+// Reset resets the ZPU to a known initial state. PC and SP are set to the
+// ResetPC and StackTop values of the configuration.
 //
 func (s *State) Reset() {
-	s.pc = 0
-	_, e, err := s.b.MappedRange(mem.MemRAM)
-	if err != nil {
-		panic(err)
+	s.pc = s.cfg.ResetPC
+	s.sp = s.cfg.StackTop
+	if s.sp == 0 {
+		_, e, err := s.b.MappedRange(mem.MemRAM)
+		if err != nil {
+			panic(err)
+		}
+		s.sp = e
 	}
-	s.sp = e
 	s.idim = false
 	s.halted = false
+	s.inIRQ = false
+	s.stop = cpu.StopInfo{}
+	s.b.WaitCycles() // discard wait cycles from host accesses
 }
 
 // SetPC sets the PC to the given address.
@@ -115,68 +186,250 @@ func (s *State) SP() mirv.Address {
 	return s.sp
 }
 
+// ZPU register indices.
+//
+const (
+	regPC = iota
+	regSP
+	regIDIM
+	regInIRQ
+)
+
+var registers = []cpu.Register{
+	regPC:    {Name: "pc", Bits: 32, Kind: cpu.RegPC},
+	regSP:    {Name: "sp", Bits: 32, Kind: cpu.RegSP},
+	regIDIM:  {Name: "idim", Bits: 1, Kind: cpu.RegFlag},
+	regInIRQ: {Name: "inirq", Bits: 1, Kind: cpu.RegFlag}, // servicing an interrupt
+}
+
+// Registers returns the ZPU registers: pc, sp, the idim flag and the inirq
+// flag which is set while an interrupt is being serviced.
+//
+func (*State) Registers() []cpu.Register {
+	return registers
+}
+
+// Reg returns the value of register i.
+//
+func (s *State) Reg(i int) uint64 {
+	switch i {
+	case regPC:
+		return uint64(uint32(s.pc))
+	case regSP:
+		return uint64(uint32(s.sp))
+	case regIDIM:
+		return uint64(b2u(s.idim))
+	case regInIRQ:
+		return uint64(b2u(s.inIRQ))
+	}
+	panic("zpu: register index out of range")
+}
+
+// SetReg sets the value of register i.
+//
+func (s *State) SetReg(i int, v uint64) {
+	switch i {
+	case regPC:
+		s.pc = mirv.Address(uint32(v))
+	case regSP:
+		s.sp = mirv.Address(uint32(v))
+	case regIDIM:
+		s.idim = v&1 != 0
+	case regInIRQ:
+		s.inIRQ = v&1 != 0
+	default:
+		panic("zpu: register index out of range")
+	}
+}
+
 func (s *State) tos() uint32 {
-	return s.read32(s.sp)
+	if s.topOK {
+		return s.top
+	}
+	v := s.read32(s.sp)
+	s.top, s.topOK = v, s.fast
+	return v
+}
+
+func (s *State) setTOS(v uint32) {
+	s.write32(s.sp, v)
+	s.top, s.topOK = v, s.fast
 }
 
 func (s *State) push(v uint32) {
 	s.sp -= 4
-	s.write32(s.sp, v)
+	s.setTOS(v)
 }
 
 func (s *State) pop() uint32 {
-	v := s.read32(s.sp)
+	v := s.tos()
 	s.sp += 4
+	s.topOK = false
 	return v
 }
 
 func (s *State) read8(addr mirv.Address) uint8 {
 	v, err := s.b.Read8(addr)
 	if err != nil {
-		panic(err)
+		panic(cpu.NewFault(cpu.FaultBus, err))
+	}
+	return v
+}
+
+func (s *State) write8(addr mirv.Address, v uint8) {
+	s.written(addr, 1)
+	err := s.b.Write8(addr, v)
+	if err != nil {
+		panic(cpu.NewFault(cpu.FaultBus, err))
+	}
+}
+
+func (s *State) read16(addr mirv.Address) uint16 {
+	v, err := s.b.Read16(addr)
+	if err != nil {
+		panic(cpu.NewFault(cpu.FaultBus, err))
+	}
+	return v
+}
+
+func (s *State) write16(addr mirv.Address, v uint16) {
+	s.written(addr, 2)
+	err := s.b.Write16(addr, v)
+	if err != nil {
+		panic(cpu.NewFault(cpu.FaultBus, err))
+	}
+}
+
+func (s *State) fetch8(addr mirv.Address) uint8 {
+	v, err := s.b.Fetch8(addr)
+	if err != nil {
+		panic(cpu.NewFault(cpu.FaultFetch, err))
 	}
 	return v
 }
 
 func (s *State) write32(addr mirv.Address, v uint32) {
+	s.written(addr, 4)
 	err := s.b.Write32(addr, v)
 	if err != nil {
-		panic(err)
+		panic(cpu.NewFault(cpu.FaultBus, err))
 	}
 }
 
-func (s State) read32(addr mirv.Address) uint32 {
+func (s *State) read32(addr mirv.Address) uint32 {
 	v, err := s.b.Read32(addr)
 	if err != nil {
-		panic(err)
+		panic(cpu.NewFault(cpu.FaultBus, err))
 	}
 	return v
 }
 
-func (s *State) syscall() {
+func b2u(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Interrupt sets the state of the interrupt line. Like the reference zpu4
+// core, interrupts are level triggered: while the line is asserted, the ZPU
+// pushes the PC and jumps to the interrupt vector at address 0x20 before
+// executing the next instruction, unless it is in the middle of an IM
+// sequence or already servicing an interrupt. Further interrupts are masked
+// until the next poppc instruction, normally the return from the interrupt
+// handler.
+//
+// The line is not affected by Reset. Interrupt has no effect on cores
+// configured without interrupt input (see Config.NoInterrupt).
+//
+func (s *State) Interrupt(assert bool) {
+	s.irq = assert && !s.cfg.NoInterrupt
+}
+
+// Stopped returns the reason why the last call to Step returned. Once the
+// guest program has exited, Step keeps returning immediately with reason
+// cpu.StopExit until the next Reset.
+//
+func (s *State) Stopped() cpu.StopInfo {
+	return s.stop
+}
 
+// RequestStop requests the current or next call to Step to return before
+// executing the next instruction. It can be called from any goroutine.
+//
+func (s *State) RequestStop() {
+	s.req.Store(true)
 }
 
 // Step steps the simulation forward n cycles. Returns how many cycles where
-// performed.
+// performed. Memory wait cycles are counted as elapsed cycles.
 //
-func (s *State) Step(n uint64) uint64 {
-	var cycles = n
+// If an instruction faults, Step returns a *cpu.Fault and the ZPU state is
+// rolled back to the beginning of that instruction.
+//
+func (s *State) Step(n uint64) (c uint64, err error) {
+	// state at the beginning of the current instruction
+	var (
+		pc, sp      mirv.Address
+		idim, inIRQ bool
+	)
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(*cpu.Fault)
+			if !ok {
+				panic(r)
+			}
+			s.pc, s.sp, s.idim, s.inIRQ = pc, sp, idim, inIRQ
+			s.cur, s.topOK = nil, false
+			f.PC = pc
+			c += s.b.WaitCycles()
+			s.stop = cpu.StopInfo{Reason: cpu.StopFault, Fault: f}
+			err = f
+		}
+	}()
 
-	for ; cycles > 0 && !s.halted; cycles-- {
+	// discard wait cycles from host accesses made since the last call
+	s.b.WaitCycles()
+	if s.halted {
+		return 0, nil
+	}
+	s.stop = cpu.StopInfo{}
+	s.fast = !s.cfg.NoCache && !s.b.Hooked()
+	s.cur, s.topOK = nil, false
+	s.gen++
+	for ; c < n && !s.halted; c += 1 + s.b.WaitCycles() {
 		var incPC = true
+		if s.req.Load() && s.req.CompareAndSwap(true, false) {
+			s.stop.Reason = cpu.StopRequest
+			return c, nil
+		}
+		pc, sp, idim, inIRQ = s.pc, s.sp, s.idim, s.inIRQ
 
-		if !s.idim {
-			// TODO: check interupts / exceptions
+		if s.irq && !s.inIRQ && !s.idim {
+			s.push(uint32(s.pc))
+			s.pc = irqVector
+			s.inIRQ = true
+			continue
 		}
 
-		insn := opcode(s.read8(s.pc))
-		// TODO: check that read8 succeeded
+		var insn opcode
+		if d := s.decoded(); d == nil {
+			insn = opcode(s.fetch8(s.pc))
+		} else if d.n > 1 && c+uint64(d.n) <= n {
+			// merged IM sequence
+			s.push(d.imm)
+			s.idim = true
+			s.pc += mirv.Address(d.n)
+			c += uint64(d.n) - 1
+			continue
+		} else {
+			insn = d.op
+		}
 
 		// Immediate
 		if insn&opIMMask == opIM {
 			if s.idim {
-				s.write32(s.sp, (s.tos()<<7)|uint32(insn&0x7F))
+				s.setTOS((s.tos() << 7) | uint32(insn&0x7F))
 			} else {
 				s.push(uint32(int32(insn) << 25 >> 25))
 				s.idim = true
@@ -188,20 +441,30 @@ func (s *State) Step(n uint64) uint64 {
 		// clear idim
 		s.idim = false
 
+		// emulate group instructions not implemented in hardware
+		if insn&opEmulateMask == opEmulate && s.hw&(1<<(insn-opEmulate)) == 0 {
+			s.push(uint32(s.pc) + 1)
+			s.pc = mirv.Address(insn-opEmulate) * 32
+			continue
+		}
+
 		switch insn {
 		case opBreakPoint:
-			return n - cycles
+			// PC is left on the breakpoint, but its cycle counts.
+			s.stop.Reason = cpu.StopBreakpoint
+			return c + 1 + s.b.WaitCycles(), nil
 		case opPopPC:
 			// Pops address off stack and sets PC
 			s.pc = mirv.Address(s.pop())
+			s.inIRQ = false
 			incPC = false
 		case opLoad:
 			// Pops address stored on stack and loads the value of that address onto stack.
-			addr := s.tos() & ^uint32(0x03)
-			s.write32(s.sp, s.read32(mirv.Address(addr)))
+			addr := s.tos() & s.m32
+			s.setTOS(s.read32(mirv.Address(addr)))
 		case opStore:
 			// Pops address, then value from stack and stores the value into the memory location of the address.
-			addr := s.pop() & ^uint32(0x03)
+			addr := s.pop() & s.m32
 			s.write32(mirv.Address(addr), s.pop())
 		case opPushSP:
 			// Pushes stack pointer.
@@ -212,18 +475,18 @@ func (s *State) Step(n uint64) uint64 {
 		case opAdd:
 			// Pops two values on stack adds them and pushes the result.
 			y := s.pop()
-			s.write32(s.sp, s.tos()+y)
+			s.setTOS(s.tos() + y)
 		case opAnd:
 			// Pops two values off the stack and does a bitwise-and & pushes the result onto the stack
 			y := s.pop()
-			s.write32(s.sp, s.tos()&y)
+			s.setTOS(s.tos() & y)
 		case opOr:
 			// Pops two integers, does a bitwise or and pushes result
 			y := s.pop()
-			s.write32(s.sp, s.tos()|y)
+			s.setTOS(s.tos() | y)
 		case opNot:
 			// Bitwise inverse of value on stack
-			s.write32(s.sp, ^s.tos())
+			s.setTOS(^s.tos())
 		case opFlip:
 			// Reverses the bit order of the value on the stack, i.e. abc->cba, 100->001, 110->011, etc.
 			v := s.tos()
@@ -231,15 +494,133 @@ func (s *State) Step(n uint64) uint64 {
 			v = (v&0x33333333)<<2 | (v>>2)&0x33333333
 			v = (v&0x0F0F0F0F)<<4 | (v>>4)&0x0F0F0F0F
 			v = (v << 24) | ((v & 0xFF00) << 8) | ((v >> 8) & 0xFF00) | (v >> 24)
-			s.write32(s.sp, v)
+			s.setTOS(v)
 		case opNop:
 
 		// implementation of emulated instructions
+		case opLoadH:
+			// Loads the 16 bits value at the address on the stack.
+			addr := s.tos() & s.m16
+			s.setTOS(uint32(s.read16(mirv.Address(addr))))
+		case opStoreH:
+			// Pops address, then value from stack and stores the lower 16
+			// bits of the value at that address.
+			addr := s.pop() & s.m16
+			s.write16(mirv.Address(addr), uint16(s.pop()))
+		case opLessThan:
+			// Pops a (TOS) and b (NOS) and pushes 1 if a < b (signed), 0
+			// otherwise. Same for the three comparisons below.
+			a := s.pop()
+			s.setTOS(b2u(int32(a) < int32(s.tos())))
+		case opLessThanOrEqual:
+			a := s.pop()
+			s.setTOS(b2u(int32(a) <= int32(s.tos())))
+		case opULessThan:
+			a := s.pop()
+			s.setTOS(b2u(a < s.tos()))
+		case opULessThanOrEqual:
+			a := s.pop()
+			s.setTOS(b2u(a <= s.tos()))
 		case opSwap:
-			v := s.read32(s.sp)
-			s.write32(s.sp, (v<<16)|(v>>16))
+			// Swaps the upper and lower 16 bits of the value on the stack.
+			v := s.tos()
+			s.setTOS((v << 16) | (v >> 16))
+		case opMult:
+			y := s.pop()
+			s.setTOS(s.tos() * y)
+		case opLShiftRight:
+			// Pops the shift amount, then shifts the value on the stack.
+			// Only the lower 6 bits of the shift amount are used.
+			n := s.pop() & 0x3F
+			s.setTOS(s.tos() >> n)
+		case opAShiftLeft:
+			n := s.pop() & 0x3F
+			s.setTOS(s.tos() << n)
+		case opAShiftRight:
+			n := s.pop() & 0x3F
+			s.setTOS(uint32(int32(s.tos()) >> n))
+		case opCall:
+			// Pops address, pushes return address and sets PC.
+			addr := s.tos()
+			s.setTOS(uint32(s.pc) + 1)
+			s.pc = mirv.Address(addr)
+			incPC = false
+		case opEq:
+			y := s.pop()
+			s.setTOS(b2u(s.tos() == y))
+		case opNeq:
+			y := s.pop()
+			s.setTOS(b2u(s.tos() != y))
+		case opNeg:
+			s.setTOS(-s.tos())
+		case opSub:
+			// Pops two values and pushes NOS - TOS.
+			y := s.pop()
+			s.setTOS(s.tos() - y)
+		case opXor:
+			y := s.pop()
+			s.setTOS(s.tos() ^ y)
+		case opLoadB:
+			// Loads the 8 bits value at the address on the stack.
+			s.setTOS(uint32(s.read8(mirv.Address(s.tos()))))
+		case opStoreB:
+			// Pops address, then value from stack and stores the lower 8
+			// bits of the value at that address.
+			addr := s.pop()
+			s.write8(mirv.Address(addr), uint8(s.pop()))
+		case opDiv:
+			// Pops a (TOS) and b (NOS) and pushes a / b (signed).
+			a := int32(s.pop())
+			b := int32(s.tos())
+			if b == 0 {
+				panic(cpu.NewFault(cpu.FaultDivide, errDivide))
+			}
+			s.setTOS(uint32(a / b))
+		case opMod:
+			a := int32(s.pop())
+			b := int32(s.tos())
+			if b == 0 {
+				panic(cpu.NewFault(cpu.FaultDivide, errDivide))
+			}
+			s.setTOS(uint32(a % b))
+		case opEqBranch:
+			// Pops a PC relative offset, then a value and branches if the
+			// value is 0.
+			off := s.pop()
+			if s.pop() == 0 {
+				s.pc = mirv.Address(uint32(s.pc) + off)
+				incPC = false
+			}
+		case opNeqBranch:
+			off := s.pop()
+			if s.pop() != 0 {
+				s.pc = mirv.Address(uint32(s.pc) + off)
+				incPC = false
+			}
+		case opPopPCRel:
+			// Pops a PC relative offset and jumps.
+			s.pc = mirv.Address(uint32(s.pc) + s.pop())
+			incPC = false
+		case opPushPC:
+			s.push(uint32(s.pc))
+		case opConfig:
+			// Pops the CPU type. The crt0 emulation routine sets _hardware
+			// instead.
+			s.pop()
 		case opSyscall:
 			s.syscall()
+		case opPushSPAdd:
+			// Replaces the value on the stack with SP + value * 4.
+			s.setTOS(s.tos()*4 + uint32(s.sp))
+		case opMult16x16:
+			y := s.pop() & 0xFFFF
+			s.setTOS((s.tos() & 0xFFFF) * y)
+		case opCallPCRel:
+			// Pops a PC relative offset, pushes return address and jumps.
+			off := s.tos()
+			s.setTOS(uint32(s.pc) + 1)
+			s.pc = mirv.Address(uint32(s.pc) + off)
+			incPC = false
 
 		default:
 			switch {
@@ -257,11 +638,7 @@ func (s *State) Step(n uint64) uint64 {
 				s.push(s.read32(addr))
 			case insn&opAddSPMask == opAddSP:
 				addr := s.sp + mirv.Address(insn-opAddSP)*4
-				s.write32(s.sp, s.read32(s.sp)+s.read32(addr))
-			case insn&opEmulateMask == opEmulate:
-				s.push(uint32(s.pc) + 1)
-				s.pc = mirv.Address(insn-opEmulate) * 32
-				incPC = false
+				s.setTOS(s.tos() + s.read32(addr))
 			}
 		}
 
@@ -270,5 +647,5 @@ func (s *State) Step(n uint64) uint64 {
 		}
 
 	}
-	return n - cycles
+	return c, nil
 }
@@ -1,10 +1,14 @@
 package zpu_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/db47h/mirv"
+	"github.com/db47h/mirv/cpu"
 	"github.com/db47h/mirv/cpu/zpu"
 	"github.com/db47h/mirv/elf"
 	"github.com/db47h/mirv/mem"
@@ -41,7 +45,6 @@ var td = [...]data{
 	{"storesp", nil, top - 4, 0x34567890},
 	{"addsp", nil, top - 8, 0x3456788F},
 	{"emul0", 0, top - 4, start + 1},
-	{"emul31", 31 * 32, top - 4, start + 1},
 
 	{"swap", nil, top - 4, 0xBEEFDEAD},
 }
@@ -76,7 +79,9 @@ func check(name string, pc interface{}, sp interface{}, tos uint32) error {
 	}
 
 	z.SetPC(entry)
-	z.Step(1000)
+	if _, err = z.Step(1000); err != nil {
+		return err
+	}
 
 	switch pc := pc.(type) {
 	case int:
@@ -120,6 +125,112 @@ func TestISA(t *testing.T) {
 	}
 }
 
+// im returns the shortest sequence of IM instructions that pushes v.
+func im(v int32) []byte {
+	var b []byte
+	for {
+		b = append([]byte{0x80 | byte(v&0x7F)}, b...)
+		if v>>6 == 0 || v>>6 == -1 {
+			return b
+		}
+		v >>= 7
+	}
+}
+
+// prog concatenates instructions.
+func prog(insns ...interface{}) []byte {
+	var p []byte
+	for _, i := range insns {
+		switch i := i.(type) {
+		case int:
+			p = append(p, byte(i))
+		case []byte:
+			p = append(p, i...)
+		}
+	}
+	return p
+}
+
+func TestEmulated(t *testing.T) {
+	const (
+		org  = 0x80 // program start address
+		data = 0x100
+		nop  = 0x0B
+		next = ^mirv.Address(0) // PC of the instruction following the program
+	)
+	for _, d := range []struct {
+		n    string
+		prog []byte
+		pc   mirv.Address
+		sp   mirv.Address
+		tos  uint32
+	}{
+		{"loadh", prog(im(data+2), 34), next, top - 4, 0x0304},
+		{"storeh", prog(im(0xBEEF), nop, im(data), 35, im(data), 8), next, top - 4, 0xBEEF0304},
+		{"lessthan", prog(im(2), nop, im(1), 36), next, top - 4, 1},
+		{"lessthan_signed", prog(im(1), nop, im(-1), 36), next, top - 4, 1},
+		{"lessthanorequal", prog(im(2), nop, im(2), 37), next, top - 4, 1},
+		{"ulessthan", prog(im(1), nop, im(-1), 38), next, top - 4, 0},
+		{"ulessthanorequal", prog(im(-1), nop, im(1), 39), next, top - 4, 1},
+		{"mult", prog(im(6), nop, im(-7), 41), next, top - 4, uint32(0xFFFFFFD6)},
+		{"lshiftright", prog(im(-16), nop, im(2), 42), next, top - 4, 0x3FFFFFFC},
+		{"ashiftleft", prog(im(3), nop, im(4), 43), next, top - 4, 48},
+		{"ashiftright", prog(im(-16), nop, im(2), 44), next, top - 4, 0xFFFFFFFC},
+		{"call", prog(im(0x40), 45), 0x40, top - 4, org + 3},
+		{"eq", prog(im(5), nop, im(5), 46), next, top - 4, 1},
+		{"neq", prog(im(5), nop, im(5), 47), next, top - 4, 0},
+		{"neg", prog(im(5), 48), next, top - 4, 0xFFFFFFFB},
+		{"sub", prog(im(10), nop, im(3), 49), next, top - 4, 7},
+		{"xor", prog(im(0x55), nop, im(0x0F), 50), next, top - 4, 0x5A},
+		{"loadb", prog(im(data+1), 51), next, top - 4, 0x02},
+		{"storeb", prog(im(0xAB), nop, im(data+3), 52, im(data), 8), next, top - 4, 0x010203AB},
+		{"div", prog(im(3), nop, im(-21), 53), next, top - 4, 0xFFFFFFF9},
+		{"mod", prog(im(5), nop, im(-23), 54), next, top - 4, 0xFFFFFFFD},
+		{"eqbranch", prog(im(0), nop, im(0x20), 55), org + 3 + 0x20, top, db},
+		{"eqbranch_not_taken", prog(im(1), nop, im(0x20), 55), next, top, db},
+		{"neqbranch", prog(im(1), nop, im(0x20), 56), org + 3 + 0x20, top, db},
+		{"neqbranch_not_taken", prog(im(0), nop, im(0x20), 56), next, top, db},
+		{"poppcrel", prog(im(0x10), 57), org + 1 + 0x10, top, db},
+		{"config", prog(58), 26 * 32, top - 4, org + 1},
+		{"pushpc", prog(59), org + 1, top - 4, org},
+		{"pushspadd", prog(im(2), 61), next, top - 4, top + 4},
+		{"mult16x16", prog(im(0x10003), nop, im(0x20005), 62), next, top - 4, 15},
+		{"callpcrel", prog(im(0x10), 63), org + 1 + 0x10, top - 4, org + 2},
+		{"emul32", prog(32), 0, top - 4, org + 1},
+		{"emul33", prog(33), 32, top - 4, org + 1},
+	} {
+		var b mem.Bus
+		z := zpu.New(&b)
+		b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+		b.Map(top, memIO{mem.NewRAM(1<<12, z.ByteOrder())})
+		b.Write32(top, db)
+		b.Write32(data, 0x01020304)
+		b.CopyIn(org, d.prog)
+		z.Reset()
+		z.SetPC(org)
+		if _, err := z.Step(1000); err != nil {
+			t.Errorf("%s: %v\n%s", d.n, err, listing(d.prog))
+			continue
+		}
+		if d.pc == next {
+			d.pc = org + mirv.Address(len(d.prog))
+		}
+		var errs []string
+		if z.PC() != d.pc {
+			errs = append(errs, fmt.Sprintf("expected PC %08X, got %08X", d.pc, z.PC()))
+		}
+		if z.SP() != d.sp {
+			errs = append(errs, fmt.Sprintf("expected SP %08X, got %08X", d.sp, z.SP()))
+		}
+		if tos, _ := b.Read32(z.SP()); tos != d.tos {
+			errs = append(errs, fmt.Sprintf("expected TOS %08X, got %08X", d.tos, tos))
+		}
+		if errs != nil {
+			t.Errorf("%s: %s\n%s", d.n, strings.Join(errs, ", "), listing(d.prog))
+		}
+	}
+}
+
 // Dummy UART. Just intercepts read/writes to MMIO.
 // A proper implementation should run in a separate goroutine.
 //
@@ -175,21 +286,425 @@ func TestNew(t *testing.T) {
 	z.Reset()
 	z.SetPC(entry)
 
-	defer func() {
-		if err := recover(); err != nil {
-			t.Logf("ZPU panic @ %08X", z.PC())
-			t.Fatal(err)
-		}
-	}()
-
-	z.Step(2000000)
-	// ts := time.Now()
-	// cycles := z.Step(2000000)
-	// d := time.Now().Sub(ts)
-	// t.Logf("%d cycles / %v -- MIPS: %.3f", cycles, d, (float64(cycles)/1000000.0)/d.Seconds())
+	if _, err = z.Step(2000000); err != nil {
+		t.Fatal(err)
+	}
 
 	if string(uart.buf) != "Hello, World!" {
 		t.Fatalf("Expected \"Hello, World!\", got %q", uart.buf)
 	}
 	t.Logf("ZPU says: %s", uart.buf)
 }
+
+func TestWaitCycles(t *testing.T) {
+	var b mem.Bus
+	z := zpu.New(&b)
+	b.Map(0, mem.NewRAM(1<<20, z.ByteOrder()))
+	_, entry, err := elf.Load(&b, "testdata/im0.elf", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.SetLatency(0, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	z.Reset()
+	z.SetPC(entry)
+	// im 0 + breakpoint: 2 cycles, 2 fetches and 1 write.
+	if c, _ := z.Step(1000); c != 2+2*2+3 {
+		t.Fatalf("Expected %d cycles, got %d", 2+2*2+3, c)
+	}
+	// host accesses between steps are not charged to the CPU
+	b.Read32(0)
+	// breakpoint: 1 cycle and 1 fetch.
+	if c, _ := z.Step(1000); c != 1+2 {
+		t.Fatalf("Expected %d cycles, got %d", 1+2, c)
+	}
+	b.Write32(0, 0)
+	z.Reset()
+	if w := b.WaitCycles(); w != 0 {
+		t.Fatalf("Expected 0 wait cycles after Reset, got %d", w)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	var b mem.Bus
+	z := zpu.New(&b).(*zpu.State)
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	b.CopyIn(0x20, []byte{0x0B, 0x04})               // handler: nop, poppc
+	b.CopyIn(org, []byte{0x81, 0x82, 0x0B, 0x0B, 0}) // im 1, im 2, nop, nop
+	z.Reset()
+	z.SetPC(org)
+
+	step := func(pc mirv.Address) {
+		t.Helper()
+		if _, err := z.Step(1); err != nil {
+			t.Fatal(err)
+		}
+		if z.PC() != pc {
+			t.Fatalf("Expected PC %08X, got %08X", pc, z.PC())
+		}
+	}
+	step(org + 1)
+	z.Interrupt(true)
+	step(org + 2) // not taken in the middle of an IM sequence
+	step(org + 3)
+	step(0x20)
+	if sp := z.SP(); sp != top-8 {
+		t.Fatalf("Expected SP %08X, got %08X", top-8, sp)
+	}
+	if v, _ := b.Read32(top - 8); v != org+3 {
+		t.Fatalf("Expected return address %08X, got %08X", org+3, v)
+	}
+	step(0x21) // masked while in the handler
+	step(org + 3)
+	step(0x20) // the line is still asserted
+	z.Interrupt(false)
+	step(0x21)
+	step(org + 3)
+	step(org + 4)
+	if v, _ := b.Read32(top - 4); v != 130 {
+		t.Fatalf("Expected TOS 130, got %d", v)
+	}
+}
+
+func TestFault(t *testing.T) {
+	const (
+		bad   = 0x200000 // unmapped address
+		dev   = 0x300000 // device that only supports 32 bits accesses at offset 0xC
+		small = 0x400000 // 2 bytes RAM block
+		nop   = 0x0B
+	)
+	for _, d := range []struct {
+		n    string
+		prog []byte
+		pc   mirv.Address
+		f    cpu.Fault
+		sp   mirv.Address
+	}{
+		{"load", prog(im(bad), 8), org, cpu.Fault{Kind: cpu.FaultBus, PC: org + 4, Addr: bad, Size: 4}, top - 4},
+		{"fetch", nil, bad, cpu.Fault{Kind: cpu.FaultFetch, PC: bad, Addr: bad, Size: 1}, top},
+		{"store", prog(im(1), nop, im(bad), 12), org, cpu.Fault{Kind: cpu.FaultBus, PC: org + 6, Addr: bad, Size: 4}, top - 8},
+		{"div", prog(im(0), nop, im(5), 53), org, cpu.Fault{Kind: cpu.FaultDivide, PC: org + 3}, top - 8},
+		{"misaligned", prog(im(0x102), 8), org, cpu.Fault{Kind: cpu.FaultMisaligned, PC: org + 2, Addr: 0x102, Size: 4}, top - 4},
+		{"loadh", prog(im(0x101), 34), org, cpu.Fault{Kind: cpu.FaultMisaligned, PC: org + 2, Addr: 0x101, Size: 2}, top - 4},
+		{"device", prog(im(dev+4), 8), org, cpu.Fault{Kind: cpu.FaultBus, PC: org + 4, Addr: dev + 4, Size: 4}, top - 4},
+		{"end", prog(im(small), 8), org, cpu.Fault{Kind: cpu.FaultBus, PC: org + 4, Addr: small, Size: 4}, top - 4},
+	} {
+		var b mem.Bus
+		z, _ := zpu.NewWithConfig(&b, zpu.Config{StackTop: top, Misaligned: true})
+		b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+		b.Map(dev, &uart{})
+		b.Map(small, mem.NewRAM(2, z.ByteOrder()))
+		b.SetAlignment(mem.AlignTrap)
+		b.CopyIn(org, d.prog)
+		z.Reset()
+		z.SetPC(d.pc)
+		_, err := z.Step(1000)
+		var f *cpu.Fault
+		if !errors.As(err, &f) {
+			t.Errorf("%s: expected a fault, got %v", d.n, err)
+			continue
+		}
+		f.Err = nil
+		if *f != d.f {
+			t.Errorf("%s: expected %+v, got %+v", d.n, d.f, *f)
+		}
+		if st := z.Stopped(); st.Reason != cpu.StopFault || st.Fault != f {
+			t.Errorf("%s: unexpected stop reason %v", d.n, st)
+		}
+		if z.PC() != d.f.PC {
+			t.Errorf("%s: expected PC %08X, got %08X", d.n, d.f.PC, z.PC())
+		}
+		if z.SP() != d.sp {
+			t.Errorf("%s: expected SP %08X, got %08X", d.n, d.sp, z.SP())
+		}
+	}
+}
+
+// TestMisaligned checks that load, store, loadh and storeh ignore the low
+// address bits by default.
+func TestMisaligned(t *testing.T) {
+	const nop = 0x0B
+	var b mem.Bus
+	z := zpu.New(&b)
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	b.SetAlignment(mem.AlignTrap)
+	b.Write32(0x100, 0x12345678)
+	// storeh 0xbeef @ 0x107, load @ 0x102, loadh @ 0x107
+	b.CopyIn(org, prog(im(0xbeef), nop, im(0x107), 35, im(0x102), 8, im(0x107), 34, 0))
+	z.Reset()
+	z.SetPC(org)
+	if _, err := z.Step(1000); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := b.Read16(0x106); v != 0xbeef {
+		t.Fatalf("storeh: expected 0xbeef @ 0x106, got %#x", v)
+	}
+	if v, _ := b.Read32(z.SP() + 4); v != 0x12345678 {
+		t.Fatalf("load: expected 0x12345678, got %#x", v)
+	}
+	if v, _ := b.Read32(z.SP()); v != 0xbeef {
+		t.Fatalf("loadh: expected 0xbeef, got %#x", v)
+	}
+}
+
+func TestStopped(t *testing.T) {
+	var b mem.Bus
+	z := zpu.New(&b)
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	b.CopyIn(org, []byte{0x0B, 0x0B, 0x0B, 0})
+	z.Reset()
+	z.SetPC(org)
+
+	step := func(n uint64, r cpu.StopReason, pc mirv.Address, cycles uint64) {
+		t.Helper()
+		c, err := z.Step(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != cycles {
+			t.Fatalf("Expected %d cycles, got %d", cycles, c)
+		}
+		if st := z.Stopped(); st.Reason != r {
+			t.Fatalf("Expected stop reason %v, got %v", r, st)
+		}
+		if z.PC() != pc {
+			t.Fatalf("Expected PC %08X, got %08X", pc, z.PC())
+		}
+	}
+	step(1, cpu.StopBudget, org+1, 1)
+	z.RequestStop()
+	step(1000, cpu.StopRequest, org+1, 0)
+	step(1000, cpu.StopBreakpoint, org+3, 3) // 2 nops and the breakpoint
+	step(1000, cpu.StopBreakpoint, org+3, 1)
+}
+
+func TestRegisters(t *testing.T) {
+	var b mem.Bus
+	z := zpu.New(&b)
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	b.CopyIn(org, []byte{0x82, 0})
+	b.Write32(top-4, 1)
+	z.Reset()
+
+	var names []string
+	for _, r := range z.Registers() {
+		names = append(names, r.Name)
+	}
+	if s := fmt.Sprint(names); s != "[pc sp idim inirq]" {
+		t.Fatalf("Unexpected registers %s", s)
+	}
+	z.SetReg(cpu.RegIndex(z, "pc"), 1<<32|org) // truncated to 32 bits
+	if err := cpu.WriteReg(z, "sp", top-4); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.WriteReg(z, "idim", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cpu.ReadReg(z, "r0"); err != cpu.ErrNoRegister {
+		t.Fatalf("Expected ErrNoRegister, got %v", err)
+	}
+	if _, err := z.Step(1); err != nil {
+		t.Fatal(err)
+	}
+	if pc, _ := cpu.ReadReg(z, "pc"); pc != org+1 {
+		t.Fatalf("Expected PC %08X, got %08X", org+1, pc)
+	}
+	if tos, _ := b.Read32(z.SP()); tos != 1<<7|2 {
+		t.Fatalf("Expected TOS %d, got %d", 1<<7|2, tos)
+	}
+	if idim := z.Reg(cpu.RegIndex(z, "idim")); idim != 1 {
+		t.Fatalf("Expected idim 1, got %d", idim)
+	}
+}
+
+func TestNewWithConfig(t *testing.T) {
+	const (
+		nop = 0x0B
+		sub = 49
+	)
+	for _, d := range []struct {
+		n   string
+		cfg zpu.Config
+		pc  mirv.Address
+	}{
+		{"full", zpu.Config{}, org + 4},
+		{"small", zpu.Config{Variant: zpu.Small}, (sub - 32) * 32},
+		{"medium", zpu.Config{Variant: zpu.Medium}, org + 4},
+		{"flex", zpu.Config{Variant: zpu.Flex}, org + 4},
+		{"custom", zpu.Config{Variant: zpu.Full, Hardware: []string{"loadb"}}, (sub - 32) * 32},
+		{"custom_sub", zpu.Config{Variant: zpu.Small, Hardware: []string{"sub"}}, org + 4},
+	} {
+		var b mem.Bus
+		z, err := zpu.NewWithConfig(&b, d.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+		b.CopyIn(org, prog(im(3), nop, im(1), sub, 0))
+		z.Reset()
+		z.SetPC(org)
+		if _, err = z.Step(4); err != nil {
+			t.Fatal(err)
+		}
+		if z.PC() != d.pc {
+			t.Errorf("%s: expected PC %08X, got %08X\n%s", d.n, d.pc, z.PC(), listing(prog(im(3), nop, im(1), sub)))
+		}
+	}
+
+	for _, cfg := range []zpu.Config{{Variant: 42}, {Hardware: []string{"foo"}}} {
+		if _, err := zpu.NewWithConfig(nil, cfg); err == nil {
+			t.Errorf("%+v: NewWithConfig succeeded", cfg)
+		}
+	}
+
+	var b mem.Bus
+	z, err := zpu.NewWithConfig(&b, zpu.Config{ResetPC: org, StackTop: 0x1000, NoInterrupt: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+	b.Write8(org, nop)
+	z.Reset()
+	if z.PC() != org || z.SP() != 0x1000 {
+		t.Fatalf("Expected PC %08X and SP %08X after Reset, got %08X and %08X", org, 0x1000, z.PC(), z.SP())
+	}
+	z.(*zpu.State).Interrupt(true)
+	if _, err = z.Step(1); err != nil {
+		t.Fatal(err)
+	}
+	if z.PC() != org+1 {
+		t.Fatalf("Expected PC %08X, got %08X", org+1, z.PC())
+	}
+}
+
+// TestVariants runs hello.elf on all variants, exercising the crt0 emulation
+// routines.
+func TestVariants(t *testing.T) {
+	for v := zpu.Full; v <= zpu.Flex; v++ {
+		uart := uart{txReady: 1}
+		var b mem.Bus
+		z, err := zpu.NewWithConfig(&b, zpu.Config{Variant: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Map(0, mem.NewRAM(1<<16, z.ByteOrder()))
+		b.Map(0x080A0000, &uart)
+		_, entry, err := elf.Load(&b, "testdata/hello.elf", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.Reset()
+		z.SetPC(entry)
+		if _, err = z.Step(2000000); err != nil {
+			t.Fatalf("variant %d: %v", v, err)
+		}
+		if string(uart.buf) != "Hello, World!" {
+			t.Errorf("variant %d: expected \"Hello, World!\", got %q", v, uart.buf)
+		}
+	}
+}
+
+// TestCache checks that self-modifying code and code loaded between calls to
+// Step are properly handled with and without caches.
+func TestCache(t *testing.T) {
+	const nop = 0x0B
+	for _, d := range []struct {
+		name  string
+		cfg   zpu.Config
+		stats bool
+	}{
+		{"cache", zpu.Config{}, false},
+		{"nocache", zpu.Config{NoCache: true}, false},
+		{"hooked", zpu.Config{}, true},
+	} {
+		var b mem.Bus
+		z, err := zpu.NewWithConfig(&b, d.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Map(0, mem.NewRAM(top, z.ByteOrder()))
+		b.SetStats(d.stats)
+		run := func(n uint64, p []byte, pc mirv.Address, tos uint32) {
+			t.Helper()
+			if p != nil {
+				b.CopyIn(org, p)
+				z.SetPC(org)
+			}
+			if _, err := z.Step(n); err != nil {
+				t.Fatalf("%s: %v", d.name, err)
+			}
+			if z.PC() != pc {
+				t.Fatalf("%s: expected PC %08X, got %08X", d.name, pc, z.PC())
+			}
+			if v, _ := b.Read32(z.SP()); v != tos {
+				t.Fatalf("%s: expected TOS %08X, got %08X", d.name, tos, v)
+			}
+		}
+		z.Reset()
+		// overwrite "im 1, breakpoint" at org+16 with "im 2, breakpoint"
+		p := prog(im(-0x7E000000), nop, im(org+16), 0x0C)
+		p = append(p, bytes.Repeat([]byte{nop}, 16-len(p))...)
+		run(1000, append(p, 0x81, 0, 0, 0), org+17, 2)
+		if d.stats {
+			// one 8 bit read per instruction fetch
+			if s := b.Stats(); s[0].Reads[0] != 18 {
+				t.Fatalf("%s: expected 18 fetches, got %d", d.name, s[0].Reads[0])
+			}
+		}
+		run(1000, prog(im(3), 0), org+1, 3)
+		// call "poppc" at org+32, overwrite it with "im 1, breakpoint" and
+		// call it again
+		p = prog(im(org+32), 45, im(-0x7F000000), nop, im(org+32), 0x0C, im(org+32), 45)
+		p = append(p, bytes.Repeat([]byte{nop}, 32-len(p))...)
+		run(1000, append(p, 0x04), org+33, 1)
+		// IM sequence split across calls to Step
+		run(1, prog(im(0x1234), 0), org+1, 0x24)
+		run(1000, nil, org+2, 0x1234)
+	}
+}
+
+func BenchmarkHello(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		cfg  zpu.Config
+	}{
+		{"cache", zpu.Config{}},
+		{"nocache", zpu.Config{NoCache: true}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			uart := uart{txReady: 1, buf: make([]byte, 0, 1024)}
+			var bus mem.Bus
+			z, err := zpu.NewWithConfig(&bus, bb.cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ram := mem.NewRAM(1<<16, z.ByteOrder())
+			bus.Map(0, ram)
+			bus.Map(0x080A0000, &uart)
+			_, entry, err := elf.Load(&bus, "testdata/hello.elf", false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			img := append([]byte(nil), mem.Bytes(ram)...)
+
+			var cycles uint64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// only time execution, not reloading the program
+				b.StopTimer()
+				copy(mem.Bytes(ram), img)
+				uart.buf = uart.buf[:0]
+				z.Reset()
+				z.SetPC(entry)
+				b.StartTimer()
+				c, err := z.Step(2000000)
+				if err != nil {
+					b.Fatal(err)
+				}
+				cycles += c
+			}
+			b.ReportMetric(float64(cycles)/1e6/b.Elapsed().Seconds(), "MIPS")
+		})
+	}
+}
@@ -103,15 +103,6 @@ type Arch struct {
 	Data    Data
 }
 
-type zeroReader struct{}
-
-func (zeroReader) Read(p []byte) (n int, err error) {
-	for i := range p {
-		p[i] = 0
-	}
-	return len(p), nil
-}
-
 // Load loads an ELF file and returns the architecture, start address and error
 // if any. If the autoAlloc parameter is true, guest memory will automatically
 // be allocated and mapped in the guest's address space.
@@ -169,7 +160,7 @@ func Load(bus *mem.Bus, name string, autoAlloc bool) (arch Arch, entry mirv.Addr
 		// This is to conform to the ELF spec. As a side effect, this clears the
 		// BSS, but this should not be taken for granted.
 		if uint64(n) < p.Memsz {
-			_, err = io.CopyN(w, zeroReader{}, int64(p.Memsz)-n)
+			err = bus.Fill(mirv.Address(p.Paddr)+mirv.Address(n), mirv.Address(p.Memsz)-mirv.Address(n), 0)
 			if err != nil {
 				return arch, entry, err
 			}
@@ -0,0 +1,174 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"io"
+
+	"github.com/db47h/mirv"
+)
+
+// aligned is the Interface returned by NewAligned.
+//
+type aligned struct {
+	m Interface
+	a Alignment
+}
+
+// NewAligned returns a memory Interface that applies the alignment policy a to
+// accesses to m, independently of the policy of the Bus it is mapped on. With
+// AlignTrap, misaligned accesses fail with an *ErrMisaligned error. With
+// AlignSplit, they are split into 8 bits accesses to m. If a is AlignAllow, m
+// is returned as-is.
+//
+// This is mostly useful for RAM blocks created by NewRAM, which otherwise
+// happily perform misaligned accesses. As for any memory Interface, the
+// address in returned errors is relative to the start of the block. The Bus
+// converts it to a guest address.
+//
+// The returned Interface has the same size, type and byte order as m. It
+// forwards the latency of m and implements Serializer like a mirror does (see
+// NewMirror). It is not a RAM block for Bytes, NewView and Bus.Slice, so that
+// host accesses do not bypass the alignment policy. Use m directly instead.
+//
+func NewAligned(m Interface, a Alignment) Interface {
+	if a == AlignAllow {
+		return m
+	}
+	return &aligned{m, a}
+}
+
+func (m *aligned) Size() mirv.Address { return m.m.Size() }
+
+func (m *aligned) Type() Type { return m.m.Type() }
+
+func (m *aligned) ByteOrder() mirv.ByteOrder { return m.m.ByteOrder() }
+
+// Latency implements Latency.
+//
+func (m *aligned) Latency() (read, write uint64) { return latency(m.m) }
+
+// alignRead returns the value of type T at address addr in m.m.
+//
+func alignRead[T word](m *aligned, addr mirv.Address) (T, error) {
+	n := sizeOf[T]()
+	if addr&mirv.Address(n-1) == 0 {
+		return blkRead[T](m.m, addr)
+	}
+	if m.a == AlignTrap {
+		return 0, &ErrMisaligned{Op: OpRead, Size: n, Addr: addr}
+	}
+	var v uint64
+	be := m.m.ByteOrder() == mirv.BigEndian
+	for i := uint8(0); i < n; i++ {
+		c, err := m.m.Read8(addr + mirv.Address(i))
+		if err != nil {
+			return 0, err
+		}
+		if be {
+			v = v<<8 | uint64(c)
+		} else {
+			v |= uint64(c) << (i * 8)
+		}
+	}
+	return T(v), nil
+}
+
+// alignWrite writes the value v of type T at address addr in m.m.
+//
+func alignWrite[T word](m *aligned, addr mirv.Address, v T) error {
+	n := sizeOf[T]()
+	if addr&mirv.Address(n-1) == 0 {
+		return blkWrite(m.m, addr, v)
+	}
+	if m.a == AlignTrap {
+		return &ErrMisaligned{Op: OpWrite, Size: n, Addr: addr}
+	}
+	be := m.m.ByteOrder() == mirv.BigEndian
+	for i := uint8(0); i < n; i++ {
+		sh := i * 8
+		if be {
+			sh = (n - 1 - i) * 8
+		}
+		if err := m.m.Write8(addr+mirv.Address(i), uint8(v>>sh)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read8 returns the 8 bits value at address addr.
+//
+func (m *aligned) Read8(addr mirv.Address) (uint8, error) { return m.m.Read8(addr) }
+
+// Write8 writes the 8 bits value to address addr.
+//
+func (m *aligned) Write8(addr mirv.Address, v uint8) error { return m.m.Write8(addr, v) }
+
+// Read16 returns the 16 bits value at address addr.
+//
+func (m *aligned) Read16(addr mirv.Address) (uint16, error) { return alignRead[uint16](m, addr) }
+
+// Write16 writes the 16 bits value to address addr.
+//
+func (m *aligned) Write16(addr mirv.Address, v uint16) error { return alignWrite(m, addr, v) }
+
+// Read32 returns the 32 bits value at address addr.
+//
+func (m *aligned) Read32(addr mirv.Address) (uint32, error) { return alignRead[uint32](m, addr) }
+
+// Write32 writes the 32 bits value to address addr.
+//
+func (m *aligned) Write32(addr mirv.Address, v uint32) error { return alignWrite(m, addr, v) }
+
+// Read64 returns the 64 bits value at address addr.
+//
+func (m *aligned) Read64(addr mirv.Address) (uint64, error) { return alignRead[uint64](m, addr) }
+
+// Write64 writes the 64 bits value to address addr.
+//
+func (m *aligned) Write64(addr mirv.Address, v uint64) error { return alignWrite(m, addr, v) }
+
+// Save implements Serializer.
+//
+func (m *aligned) Save(w io.Writer) error {
+	if p := ram(m.m); p != nil {
+		_, err := w.Write(*p)
+		return err
+	}
+	if sr, ok := m.m.(Serializer); ok {
+		return sr.Save(w)
+	}
+	return nil
+}
+
+// Load implements Serializer.
+//
+func (m *aligned) Load(r io.Reader) error {
+	if p := ram(m.m); p != nil {
+		_, err := io.ReadFull(r, *p)
+		return err
+	}
+	if sr, ok := m.m.(Serializer); ok {
+		return sr.Load(r)
+	}
+	return nil
+}
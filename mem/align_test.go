@@ -0,0 +1,89 @@
+package mem
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestNewAligned(t *testing.T) {
+	r := NewRAM(16, mirv.LittleEndian)
+	if m := NewAligned(r, AlignAllow); m != r {
+		t.Fatal("AlignAllow did not return the RAM block as-is")
+	}
+
+	m := NewAligned(r, AlignTrap)
+	if m.Size() != 16 || m.Type() != MemRAM || m.ByteOrder() != mirv.LittleEndian {
+		t.Fatalf("Wrong size, type or byte order: %d, %v, %v", m.Size(), m.Type(), m.ByteOrder())
+	}
+	if err := m.Write32(4, 0xdeadbeef); err != nil {
+		t.Fatalf("AlignTrap: unexpected error %v on aligned write", err)
+	}
+	_, err := m.Read32(6)
+	if e, ok := err.(*ErrMisaligned); !ok || e.Op != OpRead || e.Addr != 6 || e.Size != 4 {
+		t.Fatalf("AlignTrap: expected *ErrMisaligned error @ 6/4, got %v", err)
+	}
+	if err = m.Write16(1, 0); err == nil {
+		t.Fatal("AlignTrap: misaligned Write16 succeeded")
+	}
+	if v, _ := r.Read32(4); v != 0xdeadbeef {
+		t.Fatalf("AlignTrap: expected 0xdeadbeef, got %#x", v)
+	}
+
+	// the Bus policy does not override the block policy
+	var b Bus
+	b.Map(0, m)
+	if _, err = b.Read16(5); err == nil {
+		t.Fatal("AlignTrap: misaligned Bus read succeeded")
+	}
+	// errors report guest addresses
+	var b2 Bus
+	b2.Map(0, NewRAM(16, mirv.LittleEndian))
+	b2.Map(16, m)
+	var me *ErrMisaligned
+	if err = b2.Write32(18, 0); !errors.As(err, &me) || me.Op != OpWrite || me.Size != 4 || me.Addr != 18 {
+		t.Fatalf("Expected misaligned error @ 18, got %v", err)
+	}
+	b2.Preferred(16)
+	if _, err = b2.Read32(22); !errors.As(err, &me) || me.Addr != 22 {
+		t.Fatalf("Expected misaligned error @ 22, got %v", err)
+	}
+	// host accesses do not bypass the policy
+	if p := Bytes(m); p != nil {
+		t.Fatal("Bytes succeeded on aligned block")
+	}
+	if _, p := b.Slice(0); p != nil {
+		t.Fatal("Slice succeeded on aligned block")
+	}
+	if _, err = NewView(m, mirv.BigEndian); err != ErrNotRAM {
+		t.Fatal("NewView succeeded on aligned block")
+	}
+	var buf bytes.Buffer
+	if err = b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r.Write32(4, 0)
+	if err = b.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Read32(4); v != 0xdeadbeef {
+		t.Fatalf("Checkpoint: expected 0xdeadbeef, got %#x", v)
+	}
+
+	for _, bo := range []mirv.ByteOrder{mirv.LittleEndian, mirv.BigEndian} {
+		r := NewRAM(16, bo)
+		m := NewAligned(r, AlignSplit)
+		if err = m.Write64(3, 0x0102030405060708); err != nil {
+			t.Fatalf("AlignSplit: unexpected error %v", err)
+		}
+		want, _ := r.Read64(3)
+		if v, err := m.Read64(3); err != nil || v != 0x0102030405060708 || v != want {
+			t.Fatalf("AlignSplit %v: got %#x, %v, expected %#x", bo, v, err, want)
+		}
+		if _, err = m.Read32(14); err == nil {
+			t.Fatalf("AlignSplit %v: read past the end succeeded", bo)
+		}
+	}
+}
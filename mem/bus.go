@@ -28,45 +28,131 @@ import (
 	"github.com/db47h/mirv"
 )
 
+// Errors returned by Bus and memory implementations.
+//
 var (
-	errOverlap     = errors.New("memory block overlap")
-	errOverflow    = errors.New("memory block overflows address space")
-	errNoMemoryMap = errors.New("no memory mapped")
+	ErrOverlap     = errors.New("memory block overlap")
+	ErrOverflow    = errors.New("memory block overflows address space")
+	ErrNoMemoryMap = errors.New("no memory mapped")
+	ErrUnmapped    = errors.New("address not mapped")
+	ErrUnsupported = errors.New("unsupported memory access")
+	ErrPage        = errors.New("Cross page memory access")
+	ErrNotRAM      = errors.New("not a RAM block")
 )
 
-//go:generate stringer -type busOp .
-type busOp int
+// Op is a memory operation.
+//
+type Op int
+
+//go:generate stringer -type Op .
 
+// Op values.
+//
 const (
-	opRead busOp = iota
-	opWrite
+	OpRead  Op = iota // data read
+	OpWrite           // data write
+	OpFetch           // instruction fetch
 )
 
-// ErrBus wraps a bus error.
+// ErrBus is the error returned for accesses to unmapped memory or memory that
+// does not support the requested access (see NoMemory).
+//
+// Bus errors for unmapped addresses match ErrUnmapped when using errors.Is,
+// while errors returned by NoMemory for unsupported accesses to mapped memory
+// match ErrUnsupported.
+//
+// The Bus access methods also wrap any other error returned by a memory block
+// in an ErrBus, like ErrPage for RAM accesses that cross the end of a block.
+// Memory blocks report addresses relative to the start of the block; the Bus
+// converts them to guest addresses.
 //
 type ErrBus struct {
-	op   busOp
-	sz   uint8
-	addr mirv.Address
+	Op   Op           // operation
+	Size uint8        // access size in bytes, 0 for vectors longer than 255 bytes
+	Addr mirv.Address // guest address
+	Err  error        // ErrUnmapped, ErrUnsupported or the memory block error
+}
+
+func errBus(op Op, size uint8, addr mirv.Address) *ErrBus {
+	return &ErrBus{Op: op, Size: size, Addr: addr, Err: ErrUnsupported}
 }
 
-func errBus(op busOp, size uint8, addr mirv.Address) *ErrBus {
-	return &ErrBus{op: op, sz: size, addr: addr}
+func errUnmapped(op Op, size uint8, addr mirv.Address) *ErrBus {
+	return &ErrBus{Op: op, Size: size, Addr: addr, Err: ErrUnmapped}
 }
 
 func (e *ErrBus) Error() string {
-	return fmt.Sprintf("bus error: %v/%d @ address %x", e.op, e.sz, e.addr)
+	return fmt.Sprintf("bus error: %v/%d @ address %x", e.Op, e.Size, e.Addr)
+}
+
+// Unwrap returns e.Err.
+//
+func (e *ErrBus) Unwrap() error {
+	return e.Err
 }
 
+// ErrMisaligned is the error returned by the Bus read and write methods for
+// misaligned accesses when the alignment policy is set to AlignTrap, either
+// for the Bus or for the memory block (see NewAligned).
+//
+type ErrMisaligned struct {
+	Op   Op           // operation
+	Size uint8        // access size in bytes
+	Addr mirv.Address // guest address
+}
+
+func (e *ErrMisaligned) Error() string {
+	return fmt.Sprintf("misaligned access: %v/%d @ address %x", e.Op, e.Size, e.Addr)
+}
+
+// Alignment is the policy applied by a Bus to misaligned memory accesses,
+// i.e. 16, 32 or 64 bits accesses where the address is not a multiple of the
+// access size.
+//
+type Alignment uint8
+
+// Alignment values.
+//
+const (
+	AlignAllow Alignment = iota // pass misaligned accesses as-is to the memory block (default)
+	AlignTrap                   // fail misaligned accesses with an *ErrMisaligned error
+	AlignSplit                  // emulate misaligned accesses with 8 bits accesses
+)
+
+// nilMemory is the block returned by find for unmapped addresses. Its start
+// address is 0 so that bus errors report the actual guest address.
+//
 var nilMemory = &block{
-	s: ^mirv.Address(0),
+	s: 0,
 	e: 0,
-	m: NoMemory{},
+	m: unmapped{},
 }
 
 type block struct {
 	s, e mirv.Address
 	m    Interface
+	st   *Stats // access statistics, nil if disabled
+	rl   uint64 // read latency
+	wl   uint64 // write latency
+}
+
+// error converts the error err returned by the memory of b for an access of
+// size bytes at guest address addr to an error reporting guest addresses:
+// addresses in *ErrBus and *ErrMisaligned errors are rebased, other errors are
+// wrapped in an *ErrBus.
+//
+func (b *block) error(op Op, size uint8, addr mirv.Address, err error) error {
+	switch e := err.(type) {
+	case *ErrBus:
+		r := *e
+		r.Addr += b.s
+		return &r
+	case *ErrMisaligned:
+		r := *e
+		r.Addr += b.s
+		return &r
+	}
+	return &ErrBus{Op: op, Size: size, Addr: addr, Err: err}
 }
 
 func (b *block) overlaps(blk *block) bool {
@@ -81,8 +167,8 @@ func (b *block) contains(addr mirv.Address) bool {
 // guest <-> host memory mapping and helper functions for reading and writing
 // data with different byte orders.
 //
-// Read and writes do not need to be aligned but cannot cross block boundaries.
-// For example:
+// By default, reads and writes do not need to be aligned but cannot cross block
+// boundaries. For example:
 //
 //	var b Bus
 //	// map 2 x 32KiB RAM blocks at addresses 0 and 0x8000 respectively.
@@ -98,13 +184,20 @@ func (b *block) contains(addr mirv.Address) bool {
 // memory block is by default the first mapped block, and can also be set by the
 // user by calling the Preferred method.
 //
+// The handling of misaligned accesses can be changed with SetAlignment.
+//
 type Bus struct {
-	b []*block
-	p *block // preferred mem block
+	b     []*block
+	p     *block    // preferred mem block
+	a     Alignment // misaligned access policy
+	h     bool      // true if any access hook is enabled
+	stats bool      // access statistics enabled
+	tr    *Tracer   // access tracer
+	ic    *Cache    // instruction cache
+	dc    *Cache    // data cache
+	w     uint64    // wait cycles
 }
 
-//go:generate go run bus_gen.go -o bus_rw.go
-
 // Map maps a memory block starting at addr to the given Interface. Map
 // returns a non nil error if the block is block already mapped, overlaps with
 // another mapped block or if addr+m.Size() is greater than the maximum value of
@@ -116,13 +209,24 @@ func (b *Bus) Map(addr mirv.Address, m Interface) error {
 	}
 	end := addr + (m.Size() - 1)
 	if end < addr {
-		return errOverflow
+		return ErrOverflow
 	}
-	return b.insert(&block{
+	blk := &block{
 		s: addr,
 		e: end,
 		m: m,
-	})
+	}
+	if b.stats {
+		blk.st = new(Stats)
+	}
+	blk.rl, blk.wl = latency(m)
+	if err := b.insert(blk); err != nil {
+		return err
+	}
+	if blk.rl != 0 || blk.wl != 0 {
+		b.updateHooks()
+	}
+	return nil
 }
 
 func (b *Bus) insertIdx(blk *block) int {
@@ -149,7 +253,7 @@ func (b *Bus) insert(blk *block) error {
 	}
 	i := b.insertIdx(blk)
 	if b.p != nil && blk.overlaps(b.p) || i < 0 {
-		return errOverlap
+		return ErrOverlap
 	}
 	b.b = append(b.b, nil)
 	copy(b.b[i+1:], b.b[i:])
@@ -157,6 +261,60 @@ func (b *Bus) insert(blk *block) error {
 	return nil
 }
 
+// SetAlignment sets the policy for misaligned accesses. With AlignTrap, the
+// read and write methods return an *ErrMisaligned error. With AlignSplit,
+// misaligned accesses are split into 8 bits accesses that may span several
+// contiguous memory blocks. The byte order used to reassemble the value is the
+// one of the memory block containing the first byte.
+//
+// Note that aligned accesses are not affected by the alignment policy. The
+// policy can also be set for individual memory blocks with NewAligned.
+//
+func (b *Bus) SetAlignment(a Alignment) {
+	b.a = a
+}
+
+// misaligned handles misaligned accesses of size bytes at address addr
+// according to the bus alignment policy. For reads, v is ignored and the value
+// read is returned. For writes, v is the value to write.
+//
+func (b *Bus) misaligned(op Op, size uint8, addr mirv.Address, v uint64) (uint64, error) {
+	if b.a == AlignTrap {
+		return 0, &ErrMisaligned{Op: op, Size: size, Addr: addr}
+	}
+	be := b.memory(addr).m.ByteOrder() == mirv.BigEndian
+	if op != OpWrite {
+		read8 := b.Read8
+		if op == OpFetch {
+			read8 = b.Fetch8
+		}
+		for i := uint8(0); i < size; i++ {
+			c, err := read8(addr + mirv.Address(i))
+			if err != nil {
+				return 0, err
+			}
+			if be {
+				v = v<<8 | uint64(c)
+			} else {
+				v |= uint64(c) << (i * 8)
+			}
+		}
+		return v, nil
+	}
+	for i := uint8(0); i < size; i++ {
+		var c uint8
+		if be {
+			c = uint8(v >> ((size - i - 1) * 8))
+		} else {
+			c = uint8(v >> (i * 8))
+		}
+		if err := b.Write8(addr+mirv.Address(i), c); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
 // Preferred sets the preferred memory block. When resolving guest to host
 // addresses, the memory block containing addr will be checked first.
 //
@@ -195,6 +353,8 @@ func (b *Bus) Preferred(addr mirv.Address) {
 //
 // Remap panics if the size of the new memory Interface is too large to fit.
 //
+// The access latency of the block is reset to the one declared by m, if any.
+//
 // This function is meant to help implement the brk/sbrk syscalls and dynamic
 // memory bank swapping.
 //
@@ -217,11 +377,13 @@ func (b *Bus) Remap(addr mirv.Address, m Interface) error {
 	end := addr + (m.Size() - 1)
 	if s := m.Size(); s > blk.m.Size() && next < len(b.b) {
 		if end >= b.b[next].s {
-			return errOverlap
+			return ErrOverlap
 		}
 	}
 	blk.m = m
 	blk.e = end
+	blk.rl, blk.wl = latency(m)
+	b.updateHooks()
 	return nil
 }
 
@@ -263,7 +425,7 @@ func (b *Bus) MappedRange(t Type) (low, high mirv.Address, err error) {
 	if ok {
 		return low, high + 1, nil
 	}
-	return 0, 0, errNoMemoryMap
+	return 0, 0, ErrNoMemoryMap
 }
 
 // Memory returns the base address and memory Interface mapped to address addr.
@@ -277,13 +439,37 @@ func (b *Bus) MappedRange(t Type) (low, high mirv.Address, err error) {
 //	log.Printf("0x%X is in a %d bytes block mapped at 0x%X", addr, m.Size(), base)
 //
 func (b *Bus) Memory(addr mirv.Address) (mirv.Address, Interface) {
-	if len(b.b) == 0 {
-		return 0, nilMemory.m
-	}
 	e := b.memory(addr)
 	return e.s, e.m
 }
 
+// Slice returns the base address and backing host memory of the RAM block
+// mapped at address addr. If addr is not mapped or not in a RAM block created
+// by NewRAM or NewView, it returns a nil slice and the caller must fall back to
+// the regular Read and Write methods:
+//
+//	if base, p := bus.Slice(addr); p != nil {
+//		c := p[addr-base] // same as bus.Read8(addr)
+//		// ...
+//	}
+//
+// Reads and writes to the returned slice bypass the bus entirely: they are
+// not seen by stats, tracers or caches and do not add wait cycles.
+//
+func (b *Bus) Slice(addr mirv.Address) (mirv.Address, []byte) {
+	blk := b.memory(addr)
+	return blk.s, Bytes(blk.m)
+}
+
+// Hooked reports whether any access hook is enabled: stats, tracers, caches or
+// wait cycles. CPUs that bypass the Bus for performance, for example with
+// instruction caches reading host memory directly (see Slice), must fall back
+// to regular accesses when Hooked returns true.
+//
+func (b *Bus) Hooked() bool {
+	return b.h
+}
+
 // findIdx returns the index if the block containing addr. If not found, returns
 // -1. It does not check b.p.
 //
@@ -324,6 +510,101 @@ func (b *Bus) find(addr mirv.Address) *block {
 	return nilMemory
 }
 
+// blocks returns all mapped blocks, including the preferred block, in address
+// order.
+//
+func (b *Bus) blocks() []*block {
+	bs := make([]*block, 0, len(b.b)+1)
+	if b.p == nil {
+		return append(bs, b.b...)
+	}
+	i := b.insertIdx(b.p)
+	bs = append(bs, b.b[:i]...)
+	bs = append(bs, b.p)
+	return append(bs, b.b[i:]...)
+}
+
+// updateHooks updates the access hooks flag. It must be called whenever an
+// access hook is enabled or disabled.
+//
+func (b *Bus) updateHooks() {
+	b.h = b.stats || b.tr != nil || b.ic != nil || b.dc != nil
+	for _, blk := range b.blocks() {
+		if blk.rl != 0 || blk.wl != 0 {
+			b.h = true
+			return
+		}
+	}
+}
+
+// access performs a memory access of size bytes at address addr in blk and
+// runs the enabled access hooks.
+//
+func (b *Bus) access(blk *block, op Op, size uint8, addr mirv.Address, v uint64) (uint64, error) {
+	var err error
+	off := addr - blk.s
+	if op != OpWrite {
+		switch size {
+		case 1:
+			var x uint8
+			x, err = blk.m.Read8(off)
+			v = uint64(x)
+		case 2:
+			var x uint16
+			x, err = blk.m.Read16(off)
+			v = uint64(x)
+		case 4:
+			var x uint32
+			x, err = blk.m.Read32(off)
+			v = uint64(x)
+		case 8:
+			v, err = blk.m.Read64(off)
+		}
+	} else {
+		switch size {
+		case 1:
+			err = blk.m.Write8(off, uint8(v))
+		case 2:
+			err = blk.m.Write16(off, uint16(v))
+		case 4:
+			err = blk.m.Write32(off, uint32(v))
+		case 8:
+			err = blk.m.Write64(off, v)
+		}
+	}
+	if err != nil {
+		err = blk.error(op, size, addr, err)
+	}
+	b.hook(blk, op, size, addr, v, err)
+	return v, err
+}
+
+// hook runs the enabled access hooks for an access of size bytes at address
+// addr in blk. v is the value read or written.
+//
+func (b *Bus) hook(blk *block, op Op, size uint8, addr mirv.Address, v uint64, err error) {
+	if blk.st != nil {
+		blk.st.count(op, size)
+	}
+	if op == OpWrite {
+		b.w += blk.wl
+	} else {
+		b.w += blk.rl
+	}
+	if blk.m.Type() == MemRAM {
+		if op == OpFetch {
+			if b.ic != nil {
+				b.w += b.ic.access(addr, size, false)
+			}
+		} else if b.dc != nil {
+			b.w += b.dc.access(addr, size, op == OpWrite)
+		}
+	}
+	if b.tr != nil {
+		b.tr.record(blk, op, size, addr, v, err)
+	}
+}
+
 // memory finds the *block containing addr. Does check b.p.
 //
 func (b *Bus) memory(addr mirv.Address) *block {
@@ -339,21 +620,10 @@ type busWriter struct {
 }
 
 func (w *busWriter) Write(p []byte) (n int, err error) {
-	var (
-		b   = w.b
-		blk = b.memory(w.addr)
-		m   = blk.m
-	)
-	for _, c := range p {
-		if w.addr > blk.e {
-			blk = b.memory(w.addr)
-			m = blk.m
-		}
-		if err := m.Write8(w.addr-blk.s, c); err != nil {
-			return n, io.EOF
-		}
-		w.addr++
-		n++
+	n, err = w.b.CopyIn(w.addr, p)
+	w.addr += mirv.Address(n)
+	if err != nil {
+		return n, io.EOF
 	}
 	return n, nil
 }
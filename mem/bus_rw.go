@@ -24,82 +24,333 @@ import (
 	"github.com/db47h/mirv"
 )
 
-// Read8 returns the 8 bits value at address addr.
+// blkRead returns the value of type T at address addr in m.
 //
-func (b *Bus) Read8(addr mirv.Address) (uint8, error) {
+func blkRead[T word](m Interface, addr mirv.Address) (T, error) {
+	switch sizeOf[T]() {
+	case 1:
+		v, err := m.Read8(addr)
+		return T(v), err
+	case 2:
+		v, err := m.Read16(addr)
+		return T(v), err
+	case 4:
+		v, err := m.Read32(addr)
+		return T(v), err
+	default:
+		v, err := m.Read64(addr)
+		return T(v), err
+	}
+}
+
+// blkWrite writes the value v of type T at address addr in m.
+//
+func blkWrite[T word](m Interface, addr mirv.Address, v T) error {
+	switch sizeOf[T]() {
+	case 1:
+		return m.Write8(addr, uint8(v))
+	case 2:
+		return m.Write16(addr, uint16(v))
+	case 4:
+		return m.Write32(addr, uint32(v))
+	default:
+		return m.Write64(addr, uint64(v))
+	}
+}
+
+// read performs a read of type T through the bus. It is used by the wide
+// accesses in wide.go.
+//
+func read[T word](b *Bus, op Op, addr mirv.Address) (T, error) {
+	switch sizeOf[T]() {
+	case 1:
+		if op == OpFetch {
+			v, err := b.Fetch8(addr)
+			return T(v), err
+		}
+		v, err := b.Read8(addr)
+		return T(v), err
+	case 2:
+		if op == OpFetch {
+			v, err := b.Fetch16(addr)
+			return T(v), err
+		}
+		v, err := b.Read16(addr)
+		return T(v), err
+	case 4:
+		if op == OpFetch {
+			v, err := b.Fetch32(addr)
+			return T(v), err
+		}
+		v, err := b.Read32(addr)
+		return T(v), err
+	default:
+		if op == OpFetch {
+			v, err := b.Fetch64(addr)
+			return T(v), err
+		}
+		v, err := b.Read64(addr)
+		return T(v), err
+	}
+}
+
+// write performs a write of type T through the bus. See read.
+//
+func write[T word](b *Bus, addr mirv.Address, v T) error {
+	switch sizeOf[T]() {
+	case 1:
+		return b.Write8(addr, uint8(v))
+	case 2:
+		return b.Write16(addr, uint16(v))
+	case 4:
+		return b.Write32(addr, uint32(v))
+	default:
+		return b.Write64(addr, uint64(v))
+	}
+}
+
+// slowRead is the slow path of the Bus read and fetch methods. It handles
+// misaligned accesses, accesses outside of the preferred block and access
+// hooks.
+//
+func slowRead[T word](b *Bus, op Op, addr mirv.Address) (T, error) {
+	n := sizeOf[T]()
+	if addr&mirv.Address(n-1) != 0 && b.a != AlignAllow {
+		v, err := b.misaligned(op, n, addr, 0)
+		return T(v), err
+	}
 	blk := b.p
 	if !blk.contains(addr) {
 		blk = b.find(addr)
 	}
-	return blk.m.Read8(addr - blk.s)
+	if b.h {
+		v, err := b.access(blk, op, n, addr, 0)
+		return T(v), err
+	}
+	// same as blkRead, which is too large to be inlined
+	var (
+		v   T
+		err error
+	)
+	switch off := addr - blk.s; n {
+	case 1:
+		var x uint8
+		x, err = blk.m.Read8(off)
+		v = T(x)
+	case 2:
+		var x uint16
+		x, err = blk.m.Read16(off)
+		v = T(x)
+	case 4:
+		var x uint32
+		x, err = blk.m.Read32(off)
+		v = T(x)
+	default:
+		var x uint64
+		x, err = blk.m.Read64(off)
+		v = T(x)
+	}
+	if err != nil {
+		return v, blk.error(op, n, addr, err)
+	}
+	return v, nil
 }
 
-// Write8 writes the 8 bits value to address addr.
+// slowWrite is the slow path of the Bus write methods. See slowRead.
 //
-func (b *Bus) Write8(addr mirv.Address, v uint8) error {
+func slowWrite[T word](b *Bus, addr mirv.Address, v T) error {
+	n := sizeOf[T]()
+	if addr&mirv.Address(n-1) != 0 && b.a != AlignAllow {
+		_, err := b.misaligned(OpWrite, n, addr, uint64(v))
+		return err
+	}
 	blk := b.p
 	if !blk.contains(addr) {
 		blk = b.find(addr)
 	}
-	return blk.m.Write8(addr-blk.s, v)
+	if b.h {
+		_, err := b.access(blk, OpWrite, n, addr, uint64(v))
+		return err
+	}
+	// same as blkWrite, which is too large to be inlined
+	var err error
+	switch off := addr - blk.s; n {
+	case 1:
+		err = blk.m.Write8(off, uint8(v))
+	case 2:
+		err = blk.m.Write16(off, uint16(v))
+	case 4:
+		err = blk.m.Write32(off, uint32(v))
+	default:
+		err = blk.m.Write64(off, uint64(v))
+	}
+	if err != nil {
+		return blk.error(OpWrite, n, addr, err)
+	}
+	return nil
+}
+
+// The Bus access methods below only handle the common case themselves: an
+// aligned access to the preferred block with no access hook enabled. Anything
+// else goes through slowRead or slowWrite, which are kept out of line so that
+// the fast path stays as short as possible.
+
+// Read8 returns the 8 bits value at address addr.
+//
+func (b *Bus) Read8(addr mirv.Address) (uint8, error) {
+	if blk := b.p; !b.h && blk.contains(addr) {
+		v, err := blk.m.Read8(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpRead, 1, addr, err)
+		}
+		return v, nil
+	}
+	return slowRead[uint8](b, OpRead, addr)
+}
+
+// Write8 writes the 8 bits value to address addr.
+//
+func (b *Bus) Write8(addr mirv.Address, v uint8) error {
+	if blk := b.p; !b.h && blk.contains(addr) {
+		if err := blk.m.Write8(addr-blk.s, v); err != nil {
+			return blk.error(OpWrite, 1, addr, err)
+		}
+		return nil
+	}
+	return slowWrite(b, addr, v)
+}
+
+// Fetch8 returns the 8 bits value at address addr. It behaves like Read8 but
+// must be used by CPUs for instruction fetches so that they go through the
+// instruction cache, if any.
+//
+func (b *Bus) Fetch8(addr mirv.Address) (uint8, error) {
+	if blk := b.p; !b.h && blk.contains(addr) {
+		v, err := blk.m.Read8(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpFetch, 1, addr, err)
+		}
+		return v, nil
+	}
+	return slowRead[uint8](b, OpFetch, addr)
 }
 
 // Read16 returns the 16 bits value at address addr.
 //
 func (b *Bus) Read16(addr mirv.Address) (uint16, error) {
-	blk := b.p
-	if !blk.contains(addr) {
-		blk = b.find(addr)
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&1 == 0 || b.a == AlignAllow) {
+		v, err := blk.m.Read16(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpRead, 2, addr, err)
+		}
+		return v, nil
 	}
-	return blk.m.Read16(addr - blk.s)
+	return slowRead[uint16](b, OpRead, addr)
 }
 
 // Write16 writes the 16 bits value to address addr.
 //
 func (b *Bus) Write16(addr mirv.Address, v uint16) error {
-	blk := b.p
-	if !blk.contains(addr) {
-		blk = b.find(addr)
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&1 == 0 || b.a == AlignAllow) {
+		if err := blk.m.Write16(addr-blk.s, v); err != nil {
+			return blk.error(OpWrite, 2, addr, err)
+		}
+		return nil
 	}
-	return blk.m.Write16(addr-blk.s, v)
+	return slowWrite(b, addr, v)
+}
+
+// Fetch16 returns the 16 bits value at address addr. It behaves like Read16 but
+// must be used by CPUs for instruction fetches so that they go through the
+// instruction cache, if any.
+//
+func (b *Bus) Fetch16(addr mirv.Address) (uint16, error) {
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&1 == 0 || b.a == AlignAllow) {
+		v, err := blk.m.Read16(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpFetch, 2, addr, err)
+		}
+		return v, nil
+	}
+	return slowRead[uint16](b, OpFetch, addr)
 }
 
 // Read32 returns the 32 bits value at address addr.
 //
 func (b *Bus) Read32(addr mirv.Address) (uint32, error) {
-	blk := b.p
-	if !blk.contains(addr) {
-		blk = b.find(addr)
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&3 == 0 || b.a == AlignAllow) {
+		v, err := blk.m.Read32(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpRead, 4, addr, err)
+		}
+		return v, nil
 	}
-	return blk.m.Read32(addr - blk.s)
+	return slowRead[uint32](b, OpRead, addr)
 }
 
 // Write32 writes the 32 bits value to address addr.
 //
 func (b *Bus) Write32(addr mirv.Address, v uint32) error {
-	blk := b.p
-	if !blk.contains(addr) {
-		blk = b.find(addr)
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&3 == 0 || b.a == AlignAllow) {
+		if err := blk.m.Write32(addr-blk.s, v); err != nil {
+			return blk.error(OpWrite, 4, addr, err)
+		}
+		return nil
 	}
-	return blk.m.Write32(addr-blk.s, v)
+	return slowWrite(b, addr, v)
+}
+
+// Fetch32 returns the 32 bits value at address addr. It behaves like Read32 but
+// must be used by CPUs for instruction fetches so that they go through the
+// instruction cache, if any.
+//
+func (b *Bus) Fetch32(addr mirv.Address) (uint32, error) {
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&3 == 0 || b.a == AlignAllow) {
+		v, err := blk.m.Read32(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpFetch, 4, addr, err)
+		}
+		return v, nil
+	}
+	return slowRead[uint32](b, OpFetch, addr)
 }
 
 // Read64 returns the 64 bits value at address addr.
 //
 func (b *Bus) Read64(addr mirv.Address) (uint64, error) {
-	blk := b.p
-	if !blk.contains(addr) {
-		blk = b.find(addr)
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&7 == 0 || b.a == AlignAllow) {
+		v, err := blk.m.Read64(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpRead, 8, addr, err)
+		}
+		return v, nil
 	}
-	return blk.m.Read64(addr - blk.s)
+	return slowRead[uint64](b, OpRead, addr)
 }
 
 // Write64 writes the 64 bits value to address addr.
 //
 func (b *Bus) Write64(addr mirv.Address, v uint64) error {
-	blk := b.p
-	if !blk.contains(addr) {
-		blk = b.find(addr)
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&7 == 0 || b.a == AlignAllow) {
+		if err := blk.m.Write64(addr-blk.s, v); err != nil {
+			return blk.error(OpWrite, 8, addr, err)
+		}
+		return nil
+	}
+	return slowWrite(b, addr, v)
+}
+
+// Fetch64 returns the 64 bits value at address addr. It behaves like Read64 but
+// must be used by CPUs for instruction fetches so that they go through the
+// instruction cache, if any.
+//
+func (b *Bus) Fetch64(addr mirv.Address) (uint64, error) {
+	if blk := b.p; !b.h && blk.contains(addr) && (addr&7 == 0 || b.a == AlignAllow) {
+		v, err := blk.m.Read64(addr - blk.s)
+		if err != nil {
+			return v, blk.error(OpFetch, 8, addr, err)
+		}
+		return v, nil
 	}
-	return blk.m.Write64(addr-blk.s, v)
+	return slowRead[uint64](b, OpFetch, addr)
 }
@@ -1,6 +1,7 @@
 package mem
 
 import (
+	"errors"
 	"testing"
 	"testing/quick"
 
@@ -9,6 +10,13 @@ import (
 
 const psz = 1 << 12
 
+// dummy MMIO. We just reuse RAM and change its type.
+type ioMem struct {
+	Interface
+}
+
+func (m *ioMem) Type() Type { return MemIO }
+
 func TestBus_Map(t *testing.T) {
 	var b Bus
 	r := NewRAM(psz*2, mirv.LittleEndian)
@@ -213,3 +221,94 @@ func TestLittleEndian(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBus_SetAlignment(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.BigEndian))
+	b.Map(psz, NewRAM(psz, mirv.BigEndian))
+
+	// default policy
+	if err := b.Write32(1, 0xdeadbeef); err != nil {
+		t.Fatalf("AlignAllow: unexpected error %v", err)
+	}
+
+	b.SetAlignment(AlignTrap)
+	if err := b.Write32(8, 0xdeadbeef); err != nil {
+		t.Fatalf("AlignTrap: unexpected error %v on aligned write", err)
+	}
+	_, err := b.Read16(9)
+	if e, ok := err.(*ErrMisaligned); !ok || e.Addr != 9 || e.Size != 2 {
+		t.Fatalf("AlignTrap: expected *ErrMisaligned error @ 9/2, got %v", err)
+	}
+	if err = b.Write64(12, 0); err == nil {
+		t.Fatal("AlignTrap: misaligned Write64 succeeded")
+	}
+
+	// split across block boundaries
+	b.SetAlignment(AlignSplit)
+	if err = b.Write32(psz-2, 0xdeadbeef); err != nil {
+		t.Fatalf("AlignSplit: unexpected error %v", err)
+	}
+	v32, err := b.Read32(psz - 2)
+	if err != nil || v32 != 0xdeadbeef {
+		t.Fatalf("AlignSplit: got %x, %v, expected %x", v32, err, 0xdeadbeef)
+	}
+	v16, err := b.Read16(psz)
+	if err != nil || v16 != 0xbeef {
+		t.Fatalf("AlignSplit: got %x, %v, expected %x", v16, err, 0xbeef)
+	}
+	if _, err = b.Read64(psz*2 - 4); err == nil {
+		t.Fatal("AlignSplit: read past end of mapped memory succeeded")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var b Bus
+	r := NewRAM(psz, mirv.LittleEndian)
+	if err := b.Map(0, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Map(psz-1, r); err != ErrOverlap {
+		t.Fatalf("Expected ErrOverlap, got %v", err)
+	}
+	if err := b.Map(^mirv.Address(0), r); err != ErrOverflow {
+		t.Fatalf("Expected ErrOverflow, got %v", err)
+	}
+	var e *ErrBus
+	if _, err := b.Read32(psz - 2); !errors.Is(err, ErrPage) || !errors.As(err, &e) ||
+		e.Op != OpRead || e.Size != 4 || e.Addr != psz-2 {
+		t.Fatalf("Expected ErrPage bus error @ %#x, got %v", psz-2, err)
+	}
+	if _, _, err := b.MappedRange(MemIO); err != ErrNoMemoryMap {
+		t.Fatalf("Expected ErrNoMemoryMap, got %v", err)
+	}
+	err := b.Write16(psz+42, 0)
+	if !errors.Is(err, ErrUnmapped) {
+		t.Fatalf("Expected ErrUnmapped, got %v", err)
+	}
+	if !errors.As(err, &e) || e.Op != OpWrite || e.Size != 2 || e.Addr != psz+42 {
+		t.Fatalf("Unexpected bus error %v", err)
+	}
+	// mapped device that does not support 64 bits accesses
+	b.Map(psz*4, &regDev{})
+	if _, err = b.Read64(psz*4 + 8); !errors.Is(err, ErrUnsupported) || errors.Is(err, ErrUnmapped) {
+		t.Fatalf("Expected ErrUnsupported, got %v", err)
+	}
+	if !errors.As(err, &e) || e.Op != OpRead || e.Size != 8 || e.Addr != psz*4+8 {
+		t.Fatalf("Expected bus error @ %#x, got %v", psz*4+8, err)
+	}
+	// same through the slow path
+	b.Preferred(0)
+	if err = b.Write64(psz*4+8, 0); !errors.As(err, &e) || e.Op != OpWrite || e.Size != 8 || e.Addr != psz*4+8 {
+		t.Fatalf("Expected bus error @ %#x, got %v", psz*4+8, err)
+	}
+	b.Map(psz*2, NewRAM(psz, mirv.LittleEndian))
+	if _, err = b.Read32(psz*3 - 2); !errors.Is(err, ErrPage) || !errors.As(err, &e) || e.Addr != psz*3-2 {
+		t.Fatalf("Expected ErrPage bus error @ %#x, got %v", psz*3-2, err)
+	}
+	b.SetAlignment(AlignTrap)
+	var m *ErrMisaligned
+	if _, err = b.Fetch32(2); !errors.As(err, &m) || m.Op != OpFetch || m.Size != 4 || m.Addr != 2 {
+		t.Fatalf("Unexpected misaligned error %v", err)
+	}
+}
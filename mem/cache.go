@@ -0,0 +1,240 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand"
+
+	"github.com/db47h/mirv"
+)
+
+var errCacheConfig = errors.New("invalid cache configuration")
+
+// Replacement is a cache line replacement policy.
+//
+type Replacement uint8
+
+// Replacement values.
+//
+const (
+	ReplaceLRU    Replacement = iota // least recently used
+	ReplaceFIFO                      // first in, first out
+	ReplaceRandom                    // random
+)
+
+// CacheConfig describes the geometry and policies of a Cache.
+//
+type CacheConfig struct {
+	Size         int         // total size in bytes
+	LineSize     int         // line size in bytes, must be a power of 2
+	Ways         int         // associativity: 1 for direct mapped, Size/LineSize for fully associative
+	Replacement  Replacement // line replacement policy
+	WriteThrough bool        // write-through without write allocation instead of write-back with write allocation
+	HitLatency   uint64      // latency of a cache hit in cycles
+	MissLatency  uint64      // latency of a cache miss in cycles
+	Seed         int64       // random seed for ReplaceRandom
+}
+
+// CacheStats holds the hit and miss counters of a Cache.
+//
+type CacheStats struct {
+	ReadHits    uint64
+	ReadMisses  uint64
+	WriteHits   uint64
+	WriteMisses uint64
+	WriteBacks  uint64 // dirty lines written back to memory
+	Cycles      uint64 // total latency in cycles
+}
+
+// HitRatio returns the ratio of cache hits to the total number of accesses.
+//
+func (s *CacheStats) HitRatio() float64 {
+	h := s.ReadHits + s.WriteHits
+	n := h + s.ReadMisses + s.WriteMisses
+	if n == 0 {
+		return 0
+	}
+	return float64(h) / float64(n)
+}
+
+type cacheLine struct {
+	tag   mirv.Address // line address
+	stamp uint64       // time of last use for LRU, fill time for FIFO
+	valid bool
+	dirty bool
+}
+
+// Cache is a cache simulation model. It only keeps track of the state of cache
+// lines (tags, valid and dirty bits) in order to collect hit and miss
+// statistics; data is always read from or written to the underlying memory.
+// Accesses to memory blocks other than MemRAM are not cached.
+//
+// A Cache is attached to a Bus with Bus.SetCache.
+//
+type Cache struct {
+	cfg   CacheConfig
+	lines []cacheLine // sets * ways lines
+	mask  mirv.Address
+	shift uint
+	clock uint64
+	rnd   *rand.Rand
+	stats CacheStats
+}
+
+// NewCache returns a new Cache with the given configuration. The number of
+// sets, Size / (LineSize * Ways), must be a non-zero power of 2.
+//
+func NewCache(cfg CacheConfig) (*Cache, error) {
+	if cfg.LineSize <= 0 || cfg.Ways <= 0 || cfg.LineSize&(cfg.LineSize-1) != 0 {
+		return nil, errCacheConfig
+	}
+	sets := cfg.Size / (cfg.LineSize * cfg.Ways)
+	if sets <= 0 || sets&(sets-1) != 0 || sets*cfg.LineSize*cfg.Ways != cfg.Size {
+		return nil, errCacheConfig
+	}
+	c := &Cache{
+		cfg:   cfg,
+		lines: make([]cacheLine, sets*cfg.Ways),
+		mask:  mirv.Address(sets - 1),
+		shift: uint(bits.TrailingZeros(uint(cfg.LineSize))),
+	}
+	if cfg.Replacement == ReplaceRandom {
+		c.rnd = rand.New(rand.NewSource(cfg.Seed))
+	}
+	return c, nil
+}
+
+// Stats returns the cache statistics.
+//
+func (c *Cache) Stats() CacheStats {
+	return c.stats
+}
+
+// Reset invalidates all cache lines and clears statistics.
+//
+func (c *Cache) Reset() {
+	for i := range c.lines {
+		c.lines[i] = cacheLine{}
+	}
+	c.clock = 0
+	c.stats = CacheStats{}
+}
+
+// Flush writes back all dirty lines.
+//
+func (c *Cache) Flush() {
+	for i := range c.lines {
+		if l := &c.lines[i]; l.valid && l.dirty {
+			l.dirty = false
+			c.stats.WriteBacks++
+		}
+	}
+}
+
+// access simulates an access of size bytes at address addr and returns its
+// latency. Accesses spanning several cache lines access each line in turn.
+//
+func (c *Cache) access(addr mirv.Address, size uint8, write bool) uint64 {
+	var lat uint64
+	last := (addr + mirv.Address(size) - 1) >> c.shift
+	for ln := addr >> c.shift; ; ln++ {
+		lat += c.accessLine(ln, write)
+		if ln == last {
+			return lat
+		}
+	}
+}
+
+func (c *Cache) accessLine(ln mirv.Address, write bool) uint64 {
+	c.clock++
+	w := c.cfg.Ways
+	set := c.lines[int(ln&c.mask)*w:][:w]
+	for i := range set {
+		l := &set[i]
+		if !l.valid || l.tag != ln {
+			continue
+		}
+		if c.cfg.Replacement == ReplaceLRU {
+			l.stamp = c.clock
+		}
+		if write {
+			c.stats.WriteHits++
+			l.dirty = !c.cfg.WriteThrough
+		} else {
+			c.stats.ReadHits++
+		}
+		c.stats.Cycles += c.cfg.HitLatency
+		return c.cfg.HitLatency
+	}
+
+	// miss
+	c.stats.Cycles += c.cfg.MissLatency
+	if write {
+		c.stats.WriteMisses++
+		if c.cfg.WriteThrough {
+			// no write allocate
+			return c.cfg.MissLatency
+		}
+	} else {
+		c.stats.ReadMisses++
+	}
+	l := c.victim(set)
+	if l.valid && l.dirty {
+		c.stats.WriteBacks++
+	}
+	*l = cacheLine{tag: ln, stamp: c.clock, valid: true, dirty: write}
+	return c.cfg.MissLatency
+}
+
+// victim returns the line to replace in the given set.
+//
+func (c *Cache) victim(set []cacheLine) *cacheLine {
+	v := &set[0]
+	for i := range set {
+		l := &set[i]
+		if !l.valid {
+			return l
+		}
+		if l.stamp < v.stamp {
+			v = l
+		}
+	}
+	if c.rnd != nil {
+		return &set[c.rnd.Intn(len(set))]
+	}
+	return v
+}
+
+// SetCache attaches instruction and data caches to the bus. Instruction fetches
+// go through icache and all other accesses through dcache. Either can be nil
+// and the same Cache can be used for both in order to simulate a unified
+// cache.
+//
+// Caches only affect statistics and latency: cache latencies are added to the
+// bus wait cycles (see Bus.WaitCycles). The Bus is not any slower when no cache
+// is attached.
+//
+func (b *Bus) SetCache(icache, dcache *Cache) {
+	b.ic, b.dc = icache, dcache
+	b.updateHooks()
+}
@@ -0,0 +1,72 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestNewCache(t *testing.T) {
+	for _, cfg := range []CacheConfig{
+		{Size: 1024, LineSize: 24, Ways: 1},
+		{Size: 1024, LineSize: 32, Ways: 0},
+		{Size: 1024, LineSize: 32, Ways: 3},
+		{Size: 1000, LineSize: 32, Ways: 1},
+	} {
+		if _, err := NewCache(cfg); err == nil {
+			t.Errorf("Invalid configuration %+v accepted", cfg)
+		}
+	}
+}
+
+func TestBus_SetCache(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz*4, mirv.LittleEndian))
+	b.Map(psz*4, &ioMem{NewRAM(psz, mirv.LittleEndian)})
+	// 2 sets, 2 ways, 16 bytes lines
+	ic, err := NewCache(CacheConfig{Size: 64, LineSize: 16, Ways: 2, HitLatency: 1, MissLatency: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := NewCache(CacheConfig{Size: 64, LineSize: 16, Ways: 2, Replacement: ReplaceFIFO})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetCache(ic, dc)
+
+	for i := 0; i < 2; i++ {
+		for pc := mirv.Address(0); pc < 32; pc++ {
+			b.Fetch8(pc)
+		}
+	}
+	s := ic.Stats()
+	if s.ReadMisses != 2 || s.ReadHits != 62 || s.Cycles != 82 {
+		t.Fatalf("Unexpected icache stats: %+v", s)
+	}
+	if dc.Stats() != (CacheStats{}) {
+		t.Fatalf("Unexpected dcache stats: %+v", dc.Stats())
+	}
+
+	// lines 0x00, 0x20, 0x40 all map to set 0
+	b.Write32(0x00, 0)   // miss
+	b.Write32(0x20, 0)   // miss
+	b.Read32(0x00)       // hit
+	b.Read32(0x40)       // miss, evicts dirty 0x00 (FIFO)
+	b.Read32(0x20)       // hit
+	b.Read32(0x00)       // miss, evicts dirty 0x20
+	b.Read64(0x1C)       // miss 0x10, miss 0x20 evicts 0x40
+	b.Write8(0x10, 0)    // hit
+	b.Read32(psz * 4)    // uncached MMIO
+	b.Read32(psz*4 + 64) // uncached MMIO
+	s = dc.Stats()
+	if s.WriteMisses != 2 || s.WriteHits != 1 || s.ReadHits != 2 || s.ReadMisses != 4 || s.WriteBacks != 2 {
+		t.Fatalf("Unexpected dcache stats: %+v", s)
+	}
+	if r := s.HitRatio(); r != 3.0/9 {
+		t.Fatalf("Unexpected hit ratio %f", r)
+	}
+	dc.Flush()
+	if s = dc.Stats(); s.WriteBacks != 3 {
+		t.Fatalf("Unexpected write backs after Flush: %d", s.WriteBacks)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/db47h/mirv"
+)
+
+var (
+	checkpointMagic = []byte("MIRVBUS1")
+	errCheckpoint   = errors.New("invalid checkpoint format")
+	errLayout       = errors.New("checkpoint does not match bus layout")
+)
+
+// Serializer is an optional interface implemented by IO devices that can save
+// and restore their state as part of a bus checkpoint (see Bus.Save).
+//
+type Serializer interface {
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// checkpoint region data kinds.
+const (
+	cpNone   = iota // no data
+	cpRAM           // RAM contents
+	cpAlias         // RAM shared with a previous region, data is its base address
+	cpDevice        // device state
+)
+
+type region struct {
+	s, size mirv.Address
+	t       Type
+	bo      mirv.ByteOrder
+	kind    uint8
+	data    *io.LimitedReader // region data
+}
+
+// Save writes a checkpoint of the bus to w. The checkpoint contains the memory
+// map (address, size, type and byte order of every mapped block), the contents
+// of RAM blocks and the state of IO devices implementing Serializer. The whole
+// checkpoint is gzip compressed.
+//
+// RAM blocks mapped several times, directly or through views, are only saved
+// once.
+//
+func (b *Bus) Save(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	bs := b.blocks()
+	var (
+		buf  [binary.MaxVarintLen64]byte
+		seen = make(map[*uint8]mirv.Address)
+		dev  bytes.Buffer
+	)
+	putUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	bw.Write(checkpointMagic)
+	putUvarint(uint64(len(bs)))
+	for _, blk := range bs {
+		var (
+			kind uint8 = cpNone
+			data []byte
+		)
+		if p := ram(blk.m); p != nil {
+			kind, data = cpRAM, *p
+			if len(data) > 0 {
+				if s, ok := seen[&data[0]]; ok {
+					kind, data = cpAlias, buf[:binary.PutUvarint(buf[:], uint64(s))]
+					data = append([]byte(nil), data...)
+				} else {
+					seen[&data[0]] = blk.s
+				}
+			}
+		} else if sr, ok := blk.m.(Serializer); ok {
+			dev.Reset()
+			if err := sr.Save(&dev); err != nil {
+				return err
+			}
+			kind, data = cpDevice, dev.Bytes()
+		}
+		putUvarint(uint64(blk.s))
+		putUvarint(uint64(blk.m.Size()))
+		putUvarint(uint64(blk.m.Type()))
+		bw.WriteByte(byte(blk.m.ByteOrder()))
+		bw.WriteByte(kind)
+		putUvarint(uint64(len(data)))
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// readRegion reads a region header from r. The region data is not read: it
+// must be read from rg.data, which returns io.EOF at the end of the data.
+//
+func readRegion(r *bufio.Reader) (rg region, err error) {
+	var v [3]uint64
+	for i := range v {
+		if v[i], err = binary.ReadUvarint(r); err != nil {
+			return rg, err
+		}
+	}
+	rg.s, rg.size, rg.t = mirv.Address(v[0]), mirv.Address(v[1]), Type(v[2])
+	var c byte
+	if c, err = r.ReadByte(); err != nil {
+		return rg, err
+	}
+	rg.bo = mirv.ByteOrder(c)
+	if rg.kind, err = r.ReadByte(); err != nil {
+		return rg, err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return rg, err
+	}
+	switch {
+	case rg.kind == cpRAM && n != uint64(rg.size),
+		rg.kind == cpAlias && n > binary.MaxVarintLen64,
+		n > uint64(^uint(0)>>1):
+		return rg, errCheckpoint
+	}
+	rg.data = &io.LimitedReader{R: r, N: int64(n)}
+	return rg, nil
+}
+
+// Load restores a checkpoint written by Save.
+//
+// RAM blocks missing from the bus are automatically allocated and mapped. RAM
+// blocks already mapped at the same address must have the same size; they are
+// remapped with the saved byte order if necessary. IO devices cannot be
+// created by Load and must be mapped at the same address with the same size
+// and type as when the checkpoint was saved. The state of devices implementing
+// Serializer is then restored. Blocks mapped on the bus but not present in the
+// checkpoint are left untouched.
+//
+// If Load fails, the bus may be left partially restored.
+//
+func (b *Bus) Load(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(zr)
+	var hdr [8]byte
+	if _, err = io.ReadFull(br, hdr[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(hdr[:], checkpointMagic) {
+		return errCheckpoint
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	for ; n > 0; n-- {
+		rg, err := readRegion(br)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err = b.restore(&rg); err != nil {
+			return err
+		}
+		// skip any data not consumed by restore
+		if _, err = io.Copy(io.Discard, rg.data); err != nil {
+			return err
+		}
+		if rg.data.N > 0 {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	return nil
+}
+
+// restore restores a single region.
+//
+func (b *Bus) restore(rg *region) error {
+	var src Interface // source RAM for aliases
+	if rg.kind == cpAlias {
+		s, err := binary.ReadUvarint(bufio.NewReader(rg.data))
+		if err != nil {
+			return errCheckpoint
+		}
+		src = b.memory(mirv.Address(s)).m
+		if ram(src) == nil || src.Size() != rg.size {
+			return errLayout
+		}
+	}
+
+	blk := b.memory(rg.s)
+	if blk == nilMemory {
+		var m Interface
+		switch rg.kind {
+		case cpRAM:
+			// Do not trust rg.size for allocation: the buffer only grows
+			// as data is actually read.
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, rg.data); err != nil {
+				return err
+			}
+			if buf.Len() != int(rg.size) {
+				return io.ErrUnexpectedEOF
+			}
+			m = newRAM(buf.Bytes(), rg.bo)
+		case cpAlias:
+			m, _ = NewView(src, rg.bo)
+		default:
+			return errLayout
+		}
+		return b.Map(rg.s, m)
+	}
+	if blk.s != rg.s || blk.m.Size() != rg.size || blk.m.Type() != rg.t {
+		return errLayout
+	}
+	switch rg.kind {
+	case cpRAM, cpAlias:
+		p := ram(blk.m)
+		if p == nil {
+			return errLayout
+		}
+		if rg.kind == cpAlias {
+			copy(*p, *ram(src))
+		}
+		if blk.m.ByteOrder() != rg.bo {
+			v, _ := NewView(blk.m, rg.bo)
+			if err := b.Remap(rg.s, v); err != nil {
+				return err
+			}
+		}
+		if rg.kind == cpRAM {
+			if _, err := io.ReadFull(rg.data, *p); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+		}
+	case cpDevice:
+		sr, ok := blk.m.(Serializer)
+		if !ok {
+			return errLayout
+		}
+		return sr.Load(rg.data)
+	}
+	return nil
+}
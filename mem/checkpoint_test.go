@@ -0,0 +1,128 @@
+package mem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+type regDev struct {
+	NoMemory
+	reg byte
+}
+
+func (*regDev) Size() mirv.Address { return 16 }
+func (*regDev) Type() Type         { return MemIO }
+
+func (d *regDev) Save(w io.Writer) error {
+	_, err := w.Write([]byte{d.reg})
+	return err
+}
+
+func (d *regDev) Load(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil || len(b) != 1 {
+		return errCheckpoint
+	}
+	d.reg = b[0]
+	return nil
+}
+
+func TestBus_Save(t *testing.T) {
+	var (
+		b   Bus
+		buf bytes.Buffer
+	)
+	r := NewRAM(psz, mirv.LittleEndian)
+	v, _ := NewView(r, mirv.BigEndian)
+	b.Map(0, r)
+	b.Map(psz, v)
+	b.Map(psz*4, NewRAM(psz*2, mirv.BigEndian))
+	b.Map(0x10000, &regDev{reg: 42})
+	b.Write32(8, 0xdeadbeef)
+	b.Write64(psz*5, 0x0123456789abcdef)
+	if err := b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// restore in a bus with only the device mapped
+	var nb Bus
+	dev := &regDev{}
+	nb.Map(0x10000, dev)
+	if err := nb.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if dev.reg != 42 {
+		t.Fatalf("Device state not restored: got %d", dev.reg)
+	}
+	if x, err := nb.Read32(8); err != nil || x != 0xdeadbeef {
+		t.Fatalf("Expected 0xdeadbeef, got %x, %v", x, err)
+	}
+	if x, err := nb.Read32(psz + 8); err != nil || x != 0xefbeadde {
+		t.Fatalf("Expected 0xefbeadde, got %x, %v", x, err)
+	}
+	if x, err := nb.Read64(psz * 5); err != nil || x != 0x0123456789abcdef {
+		t.Fatalf("Expected 0x0123456789abcdef, got %x, %v", x, err)
+	}
+	// aliases must still share memory
+	nb.Write8(0, 0x55)
+	if x, _ := nb.Read8(psz); x != 0x55 {
+		t.Fatal("RAM view not restored as alias")
+	}
+
+	// restore over existing memory
+	b.Write32(8, 0)
+	b.Write64(psz*5, 0)
+	if err := b.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := b.Read64(psz * 5); err != nil || x != 0x0123456789abcdef {
+		t.Fatalf("Expected 0x0123456789abcdef, got %x, %v", x, err)
+	}
+
+	// missing device
+	var eb Bus
+	if err := eb.Load(bytes.NewReader(buf.Bytes())); err != errLayout {
+		t.Fatalf("Expected error %v, got %v", errLayout, err)
+	}
+}
+
+// checkpoint returns a checkpoint with a single region header and no data.
+func checkpoint(s, size mirv.Address, t Type, kind uint8, n uint64) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(checkpointMagic)
+	for _, v := range []uint64{1, uint64(s), uint64(size), uint64(t)} {
+		zw.Write(binary.AppendUvarint(nil, v))
+	}
+	zw.Write([]byte{byte(mirv.LittleEndian), kind})
+	zw.Write(binary.AppendUvarint(nil, n))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestBus_Load_corrupt(t *testing.T) {
+	const huge = 1 << 60
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.LittleEndian))
+	b.Map(0x10000, &regDev{})
+	for _, d := range []struct {
+		name string
+		cp   []byte
+		err  error
+	}{
+		{"unmapped RAM", checkpoint(psz, huge, MemRAM, cpRAM, huge), io.ErrUnexpectedEOF},
+		{"mapped RAM", checkpoint(0, huge, MemRAM, cpRAM, huge), errLayout},
+		{"device", checkpoint(0x10000, 16, MemIO, cpDevice, huge), errCheckpoint},
+		{"alias", checkpoint(psz, psz, MemRAM, cpAlias, huge), errCheckpoint},
+	} {
+		if err := b.Load(bytes.NewReader(d.cp)); err != d.err {
+			t.Errorf("%s: expected error %v, got %v", d.name, d.err, err)
+		}
+	}
+}
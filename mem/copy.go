@@ -0,0 +1,163 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"github.com/db47h/mirv"
+)
+
+// span returns the host slice backing guest memory at addr, at most n bytes
+// long. It returns nil if addr is not in a RAM block or if access hooks are
+// enabled, in which case the caller must fall back to regular bus accesses.
+//
+func (b *Bus) span(addr mirv.Address, n mirv.Address) []uint8 {
+	if b.h {
+		return nil
+	}
+	base, s := b.Slice(addr)
+	if s == nil {
+		return nil
+	}
+	s = s[addr-base:]
+	if mirv.Address(len(s)) > n {
+		s = s[:n]
+	}
+	return s
+}
+
+// CopyIn copies the bytes in p to guest memory starting at addr and returns
+// the number of bytes copied. The destination can span several contiguous
+// memory blocks.
+//
+// RAM blocks are written to directly with host memory copies, other blocks
+// are written one byte at a time with Write8. If any access hooks are enabled
+// (stats, tracer, caches or latency), all accesses go through Write8.
+//
+func (b *Bus) CopyIn(addr mirv.Address, p []byte) (n int, err error) {
+	for n < len(p) {
+		if s := b.span(addr, mirv.Address(len(p)-n)); s != nil {
+			c := copy(s, p[n:])
+			addr += mirv.Address(c)
+			n += c
+			continue
+		}
+		if err = b.Write8(addr, p[n]); err != nil {
+			return n, err
+		}
+		addr++
+		n++
+	}
+	return n, nil
+}
+
+// CopyOut copies guest memory starting at addr into p and returns the number
+// of bytes copied. See CopyIn.
+//
+func (b *Bus) CopyOut(p []byte, addr mirv.Address) (n int, err error) {
+	for n < len(p) {
+		if s := b.span(addr, mirv.Address(len(p)-n)); s != nil {
+			c := copy(p[n:], s)
+			addr += mirv.Address(c)
+			n += c
+			continue
+		}
+		if p[n], err = b.Read8(addr); err != nil {
+			return n, err
+		}
+		addr++
+		n++
+	}
+	return n, nil
+}
+
+// Fill sets n bytes of guest memory starting at addr to v. See CopyIn.
+//
+func (b *Bus) Fill(addr mirv.Address, n mirv.Address, v uint8) error {
+	for n > 0 {
+		if s := b.span(addr, n); s != nil {
+			for i := range s {
+				s[i] = v
+			}
+			addr += mirv.Address(len(s))
+			n -= mirv.Address(len(s))
+			continue
+		}
+		if err := b.Write8(addr, v); err != nil {
+			return err
+		}
+		addr++
+		n--
+	}
+	return nil
+}
+
+// moveBufSize is the size of the intermediate buffer used by Move.
+//
+const moveBufSize = 4096
+
+// Move copies n bytes of guest memory from src to dst. Like the built-in copy
+// function, it handles overlapping source and destination correctly. See
+// CopyIn.
+//
+func (b *Bus) Move(dst, src mirv.Address, n mirv.Address) error {
+	if n == 0 {
+		return nil
+	}
+	// fast path: both ranges in RAM blocks
+	if d, s := b.span(dst, n), b.span(src, n); mirv.Address(len(d)) == n && mirv.Address(len(s)) == n {
+		copy(d, s)
+		return nil
+	}
+	buf := make([]byte, moveBufSize)
+	if dst-src >= n {
+		// dst before src or no overlap: copy forward
+		for n > 0 {
+			p := buf
+			if n < moveBufSize {
+				p = buf[:n]
+			}
+			if _, err := b.CopyOut(p, src); err != nil {
+				return err
+			}
+			if _, err := b.CopyIn(dst, p); err != nil {
+				return err
+			}
+			l := mirv.Address(len(p))
+			dst, src, n = dst+l, src+l, n-l
+		}
+		return nil
+	}
+	// dst overlaps the end of src: copy backward
+	for n > 0 {
+		p := buf
+		if n < moveBufSize {
+			p = buf[:n]
+		}
+		n -= mirv.Address(len(p))
+		if _, err := b.CopyOut(p, src+n); err != nil {
+			return err
+		}
+		if _, err := b.CopyIn(dst+n, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
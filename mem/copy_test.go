@@ -0,0 +1,107 @@
+package mem
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+// newCopyBus returns a bus with RAM, IO and RAM blocks mapped contiguously.
+func newCopyBus() *Bus {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.LittleEndian))
+	b.Map(psz, &ioMem{NewRAM(psz, mirv.LittleEndian)})
+	b.Map(psz*2, NewRAM(psz, mirv.BigEndian))
+	return &b
+}
+
+func pattern(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i*7 + 1)
+	}
+	return p
+}
+
+func TestBus_CopyIn(t *testing.T) {
+	for _, stats := range []bool{false, true} {
+		b := newCopyBus()
+		b.SetStats(stats)
+		p := pattern(psz * 2)
+		if n, err := b.CopyIn(psz/2, p); n != len(p) || err != nil {
+			t.Fatalf("CopyIn: %d, %v", n, err)
+		}
+		q := make([]byte, len(p))
+		if n, err := b.CopyOut(q, psz/2); n != len(q) || err != nil {
+			t.Fatalf("CopyOut: %d, %v", n, err)
+		}
+		if !bytes.Equal(p, q) {
+			t.Fatal("CopyOut does not match CopyIn")
+		}
+		for i := range p {
+			if c, _ := b.Read8(psz/2 + mirv.Address(i)); c != p[i] {
+				t.Fatalf("@ %#x: expected %#x, got %#x", psz/2+i, p[i], c)
+			}
+		}
+		if stats {
+			if r := b.Stats()[0].Writes[0]; r != psz/2 {
+				t.Fatalf("Expected %d byte writes, got %d", psz/2, r)
+			}
+		}
+		var e *ErrBus
+		if n, err := b.CopyIn(psz*3-4, p); n != 4 || !errors.As(err, &e) || e.Addr != psz*3 {
+			t.Fatalf("Expected 4 bytes and bus error, got %d, %v", n, err)
+		}
+		if n, err := b.CopyOut(q, psz*3-4); n != 4 || !errors.As(err, &e) || e.Addr != psz*3 {
+			t.Fatalf("Expected 4 bytes and bus error, got %d, %v", n, err)
+		}
+	}
+}
+
+func TestBus_Fill(t *testing.T) {
+	b := newCopyBus()
+	if err := b.Fill(16, psz*3-32, 0xa5); err != nil {
+		t.Fatal(err)
+	}
+	for addr := mirv.Address(0); addr < psz*3; addr++ {
+		exp := uint8(0xa5)
+		if addr < 16 || addr >= psz*3-16 {
+			exp = 0
+		}
+		if c, _ := b.Read8(addr); c != exp {
+			t.Fatalf("@ %#x: expected %#x, got %#x", addr, exp, c)
+		}
+	}
+	if err := b.Fill(psz*3-1, 2, 0); err == nil {
+		t.Fatal("Fill of unmapped memory succeeded")
+	}
+}
+
+func TestBus_Move(t *testing.T) {
+	for _, td := range []struct {
+		dst, src, n mirv.Address
+	}{
+		{0, 100, 200},                    // RAM, forward overlap
+		{100, 0, 200},                    // RAM, backward overlap
+		{psz + 10, psz, psz - 20},        // IO, backward overlap
+		{psz, psz + 10, psz - 20},        // IO, forward overlap
+		{psz - 100, psz*2 - 4, psz},      // across blocks, no overlap
+		{psz / 2, psz/2 + 1000, psz * 2}, // across blocks, forward overlap
+		{psz/2 + 1000, psz / 2, psz * 2}, // across blocks, backward overlap
+	} {
+		b := newCopyBus()
+		mem := pattern(psz * 3)
+		b.CopyIn(0, mem)
+		if err := b.Move(td.dst, td.src, td.n); err != nil {
+			t.Fatal(err)
+		}
+		copy(mem[td.dst:td.dst+td.n], mem[td.src:td.src+td.n])
+		q := make([]byte, len(mem))
+		b.CopyOut(q, 0)
+		if !bytes.Equal(mem, q) {
+			t.Fatalf("Move(%#x, %#x, %d): wrong memory contents", td.dst, td.src, td.n)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/db47h/mirv"
+)
+
+type snapRegion struct {
+	s    mirv.Address
+	data []byte
+}
+
+// Snapshot holds a copy of the contents of all RAM blocks mapped on a Bus at a
+// given point in time. IO devices are not part of snapshots.
+//
+type Snapshot struct {
+	r []snapRegion
+}
+
+// ramRegions returns the RAM blocks mapped on the bus, in address order. The
+// data of the returned regions points directly to the RAM backing memory.
+//
+func (b *Bus) ramRegions() []snapRegion {
+	var rs []snapRegion
+	for _, blk := range b.blocks() {
+		if p := ram(blk.m); p != nil {
+			rs = append(rs, snapRegion{s: blk.s, data: *p})
+		}
+	}
+	return rs
+}
+
+// Snapshot returns a snapshot of the contents of all RAM blocks mapped on the
+// bus.
+//
+func (b *Bus) Snapshot() *Snapshot {
+	rs := b.ramRegions()
+	for i := range rs {
+		rs[i].data = append([]byte(nil), rs[i].data...)
+	}
+	return &Snapshot{rs}
+}
+
+// Change describes a contiguous range of guest memory that differs between two
+// snapshots.
+//
+type Change struct {
+	Addr mirv.Address
+	Old  []byte
+	New  []byte
+}
+
+// Diff returns the ranges of memory that differ between s and a newer snapshot
+// n, in address order. Only addresses mapped to RAM in both snapshots are
+// compared.
+//
+func (s *Snapshot) Diff(n *Snapshot) []Change {
+	return diff(s.r, n.r)
+}
+
+// DiffBus returns the ranges of memory that differ between s and the current
+// contents of b, in address order. Only addresses mapped to RAM in both s and b
+// are compared.
+//
+func (s *Snapshot) DiffBus(b *Bus) []Change {
+	return diff(s.r, b.ramRegions())
+}
+
+func diff(o, n []snapRegion) []Change {
+	var cs []Change
+	for i, j := 0, 0; i < len(o) && j < len(n); {
+		or, nr := &o[i], &n[j]
+		oe := or.s + mirv.Address(len(or.data)-1)
+		ne := nr.s + mirv.Address(len(nr.data)-1)
+		// compare the intersection of both regions
+		s, e := or.s, oe
+		if nr.s > s {
+			s = nr.s
+		}
+		if ne < e {
+			e = ne
+		}
+		if s <= e {
+			cs = diffRange(cs, s, or.data[s-or.s:e-or.s+1], nr.data[s-nr.s:e-nr.s+1])
+		}
+		if oe < ne {
+			i++
+		} else {
+			j++
+		}
+	}
+	return cs
+}
+
+// diffRange appends the ranges that differ between old and new, starting at
+// address addr, to cs.
+//
+func diffRange(cs []Change, addr mirv.Address, old, new []byte) []Change {
+	for i := 0; i < len(old); {
+		if old[i] == new[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(old) && old[j] != new[j] {
+			j++
+		}
+		cs = append(cs, Change{
+			Addr: addr + mirv.Address(i),
+			Old:  append([]byte(nil), old[i:j]...),
+			New:  append([]byte(nil), new[i:j]...),
+		})
+		i = j
+	}
+	return cs
+}
+
+// WriteDiff writes a hexdump style report of the given changes to w. For each
+// change, old and new bytes are printed on alternate lines prefixed with '-'
+// and '+' respectively.
+//
+func WriteDiff(w io.Writer, cs []Change) error {
+	bw := bufio.NewWriter(w)
+	for i := range cs {
+		c := &cs[i]
+		fmt.Fprintf(bw, "@ %08x, %d bytes\n", c.Addr, len(c.Old))
+		for o := 0; o < len(c.Old); o += 16 {
+			e := o + 16
+			if e > len(c.Old) {
+				e = len(c.Old)
+			}
+			hexLine(bw, '-', c.Addr+mirv.Address(o), c.Old[o:e])
+			hexLine(bw, '+', c.Addr+mirv.Address(o), c.New[o:e])
+		}
+	}
+	return bw.Flush()
+}
+
+func hexLine(w *bufio.Writer, prefix byte, addr mirv.Address, p []byte) {
+	fmt.Fprintf(w, "%c %08x ", prefix, addr)
+	for i := 0; i < 16; i++ {
+		if i < len(p) {
+			fmt.Fprintf(w, " %02x", p[i])
+		} else {
+			w.WriteString("   ")
+		}
+	}
+	w.WriteString("  |")
+	for _, c := range p {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		w.WriteByte(c)
+	}
+	w.WriteString("|\n")
+}
@@ -0,0 +1,52 @@
+package mem
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestSnapshot_Diff(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.BigEndian))
+	b.Map(psz*2, NewRAM(psz, mirv.BigEndian))
+	b.Map(psz*4, &ioMem{NewRAM(psz, mirv.BigEndian)})
+	b.Write32(psz-4, 0x41424344)
+	s := b.Snapshot()
+
+	b.Write32(4, 0x00010000)
+	b.Write32(psz-4, 0x41420000)
+	b.Write64(psz*2+14, 0x4d4952560a000000)
+	b.Write8(psz*4, 1) // IO, ignored
+
+	exp := []Change{
+		{5, []byte{0}, []byte{1}},
+		{psz - 2, []byte{0x43, 0x44}, []byte{0, 0}},
+		{psz*2 + 14, []byte{0, 0, 0, 0, 0}, []byte{0x4d, 0x49, 0x52, 0x56, 0x0a}},
+	}
+
+	cs := s.DiffBus(&b)
+	if len(cs) != len(exp) {
+		t.Fatalf("Expected %d changes, got %d: %v", len(exp), len(cs), cs)
+	}
+	for i := range cs {
+		if cs[i].Addr != exp[i].Addr || !bytes.Equal(cs[i].Old, exp[i].Old) || !bytes.Equal(cs[i].New, exp[i].New) {
+			t.Fatalf("Change %d: expected %v, got %v", i, exp[i], cs[i])
+		}
+	}
+	if n := len(s.Diff(b.Snapshot())); n != len(exp) {
+		t.Fatalf("Expected %d changes, got %d", len(exp), n)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, cs[2:]); err != nil {
+		t.Fatal(err)
+	}
+	const report = "@ 0000200e, 5 bytes\n" +
+		"- 0000200e  00 00 00 00 00                                   |.....|\n" +
+		"+ 0000200e  4d 49 52 56 0a                                   |MIRV.|\n"
+	if buf.String() != report {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", report, buf.String())
+	}
+}
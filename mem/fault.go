@@ -0,0 +1,248 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+
+	"github.com/db47h/mirv"
+)
+
+// ErrInjected is wrapped by the *ErrBus errors returned by a FaultInjector
+// for injected bus errors.
+//
+var ErrInjected = errors.New("injected bus error")
+
+// StuckBits describes the stuck bits of a single byte of memory: bits set in
+// Mask always read as the corresponding bits in Value.
+//
+type StuckBits struct {
+	Mask  uint8
+	Value uint8
+}
+
+// FaultConfig describes the faults injected by a FaultInjector. Addresses are
+// relative to the start of the wrapped memory block. Probabilities are in the
+// range [0, 1] and apply independently to each access.
+//
+type FaultConfig struct {
+	FlipRate   float64                    // probability of a single bit flip in the value returned by a read
+	ErrorRate  float64                    // probability of a bus error on any access
+	DropRate   float64                    // probability of a write being silently dropped
+	ErrorAddrs []mirv.Address             // accesses touching any of these addresses always fail
+	Stuck      map[mirv.Address]StuckBits // stuck bits, applied on read
+	Seed       int64                      // random seed
+}
+
+// FaultStats holds the number of faults injected by a FaultInjector.
+//
+type FaultStats struct {
+	Flips  uint64 // bit flips
+	Errors uint64 // bus errors
+	Drops  uint64 // dropped writes
+}
+
+// FaultInjector is a memory Interface wrapper that injects faults in accesses
+// to the wrapped memory: bit flips on read, bus errors, stuck bits and dropped
+// writes. All random faults come from a seeded pseudo random number generator
+// so that runs are reproducible.
+//
+// Injected bus errors are of type *ErrBus and wrap ErrInjected.
+//
+// A FaultInjector has the same size, type and byte order as the memory it
+// wraps and forwards its latency. It implements Serializer like a mirror does
+// (see NewMirror). It can replace an already mapped block with Bus.Remap:
+//
+//	_, m := bus.Memory(addr)
+//	fi := mem.NewFaultInjector(m, mem.FaultConfig{FlipRate: 1e-6, Seed: 42})
+//	bus.Remap(addr, fi)
+//
+type FaultInjector struct {
+	m     Interface
+	cfg   FaultConfig
+	errs  map[mirv.Address]struct{}
+	rnd   *rand.Rand
+	stats FaultStats
+}
+
+// NewFaultInjector returns a new FaultInjector that wraps m and injects faults
+// according to cfg.
+//
+func NewFaultInjector(m Interface, cfg FaultConfig) *FaultInjector {
+	f := &FaultInjector{
+		m:    m,
+		cfg:  cfg,
+		errs: make(map[mirv.Address]struct{}, len(cfg.ErrorAddrs)),
+		rnd:  rand.New(rand.NewSource(cfg.Seed)),
+	}
+	for _, a := range cfg.ErrorAddrs {
+		f.errs[a] = struct{}{}
+	}
+	return f
+}
+
+// Memory returns the wrapped memory.
+//
+func (f *FaultInjector) Memory() Interface { return f.m }
+
+// Stats returns the fault injection statistics.
+//
+func (f *FaultInjector) Stats() FaultStats { return f.stats }
+
+func (f *FaultInjector) Size() mirv.Address { return f.m.Size() }
+
+func (f *FaultInjector) Type() Type { return f.m.Type() }
+
+func (f *FaultInjector) ByteOrder() mirv.ByteOrder { return f.m.ByteOrder() }
+
+// Latency implements Latency.
+//
+func (f *FaultInjector) Latency() (read, write uint64) { return latency(f.m) }
+
+// chance returns true with probability p.
+//
+func (f *FaultInjector) chance(p float64) bool {
+	return p > 0 && f.rnd.Float64() < p
+}
+
+// fail returns a bus error if the access of size n at addr must fail.
+//
+func (f *FaultInjector) fail(op Op, addr mirv.Address, n uint8) error {
+	fail := false
+	for i := mirv.Address(0); i < mirv.Address(n) && len(f.errs) > 0; i++ {
+		if _, ok := f.errs[addr+i]; ok {
+			fail = true
+			break
+		}
+	}
+	if !fail && !f.chance(f.cfg.ErrorRate) {
+		return nil
+	}
+	f.stats.Errors++
+	return &ErrBus{Op: op, Size: n, Addr: addr, Err: ErrInjected}
+}
+
+// faultRead reads the value of type T at address addr and applies stuck bits
+// and bit flips.
+//
+func faultRead[T word](f *FaultInjector, addr mirv.Address) (T, error) {
+	n := sizeOf[T]()
+	if err := f.fail(OpRead, addr, n); err != nil {
+		return 0, err
+	}
+	v, err := blkRead[T](f.m, addr)
+	if err != nil {
+		return v, err
+	}
+	if len(f.cfg.Stuck) > 0 {
+		be := f.m.ByteOrder() == mirv.BigEndian
+		for i := uint8(0); i < n; i++ {
+			s, ok := f.cfg.Stuck[addr+mirv.Address(i)]
+			if !ok {
+				continue
+			}
+			sh := i * 8
+			if be {
+				sh = (n - 1 - i) * 8
+			}
+			v = v&^(T(s.Mask)<<sh) | T(s.Value&s.Mask)<<sh
+		}
+	}
+	if f.chance(f.cfg.FlipRate) {
+		v ^= 1 << f.rnd.Intn(int(n)*8)
+		f.stats.Flips++
+	}
+	return v, nil
+}
+
+// faultWrite writes the value v of type T at address addr unless the write is
+// dropped.
+//
+func faultWrite[T word](f *FaultInjector, addr mirv.Address, v T) error {
+	if err := f.fail(OpWrite, addr, sizeOf[T]()); err != nil {
+		return err
+	}
+	if f.chance(f.cfg.DropRate) {
+		f.stats.Drops++
+		return nil
+	}
+	return blkWrite(f.m, addr, v)
+}
+
+// Read8 returns the 8 bits value at address addr.
+//
+func (f *FaultInjector) Read8(addr mirv.Address) (uint8, error) { return faultRead[uint8](f, addr) }
+
+// Write8 writes the 8 bits value to address addr.
+//
+func (f *FaultInjector) Write8(addr mirv.Address, v uint8) error { return faultWrite(f, addr, v) }
+
+// Read16 returns the 16 bits value at address addr.
+//
+func (f *FaultInjector) Read16(addr mirv.Address) (uint16, error) { return faultRead[uint16](f, addr) }
+
+// Write16 writes the 16 bits value to address addr.
+//
+func (f *FaultInjector) Write16(addr mirv.Address, v uint16) error { return faultWrite(f, addr, v) }
+
+// Read32 returns the 32 bits value at address addr.
+//
+func (f *FaultInjector) Read32(addr mirv.Address) (uint32, error) { return faultRead[uint32](f, addr) }
+
+// Write32 writes the 32 bits value to address addr.
+//
+func (f *FaultInjector) Write32(addr mirv.Address, v uint32) error { return faultWrite(f, addr, v) }
+
+// Read64 returns the 64 bits value at address addr.
+//
+func (f *FaultInjector) Read64(addr mirv.Address) (uint64, error) { return faultRead[uint64](f, addr) }
+
+// Write64 writes the 64 bits value to address addr.
+//
+func (f *FaultInjector) Write64(addr mirv.Address, v uint64) error { return faultWrite(f, addr, v) }
+
+// Save implements Serializer.
+//
+func (f *FaultInjector) Save(w io.Writer) error {
+	if p := ram(f.m); p != nil {
+		_, err := w.Write(*p)
+		return err
+	}
+	if sr, ok := f.m.(Serializer); ok {
+		return sr.Save(w)
+	}
+	return nil
+}
+
+// Load implements Serializer.
+//
+func (f *FaultInjector) Load(r io.Reader) error {
+	if p := ram(f.m); p != nil {
+		_, err := io.ReadFull(r, *p)
+		return err
+	}
+	if sr, ok := f.m.(Serializer); ok {
+		return sr.Load(r)
+	}
+	return nil
+}
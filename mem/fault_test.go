@@ -0,0 +1,99 @@
+package mem
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestFaultInjector(t *testing.T) {
+	var b Bus
+	r := NewRAM(psz, mirv.BigEndian)
+	b.Map(0, r)
+	f := NewFaultInjector(r, FaultConfig{
+		ErrorAddrs: []mirv.Address{0x103},
+		Stuck:      map[mirv.Address]StuckBits{0x11: {Mask: 0x81, Value: 0x01}},
+	})
+	if err := b.Remap(0, f); err != nil {
+		t.Fatal(err)
+	}
+	var e *ErrBus
+	if _, err := b.Read32(0x100); !errors.Is(err, ErrInjected) || !errors.As(err, &e) ||
+		e.Op != OpRead || e.Addr != 0x100 || e.Size != 4 {
+		t.Fatalf("Expected injected bus error, got %v", err)
+	}
+	if err := b.Write8(0x103, 0); !errors.Is(err, ErrInjected) {
+		t.Fatalf("Expected injected error, got %v", err)
+	}
+	if err := b.Write8(0x104, 0); err != nil {
+		t.Fatal(err)
+	}
+	b.Write32(0x10, 0xffffffff)
+	if v, _ := b.Read32(0x10); v != 0xff7fffff {
+		t.Fatalf("Expected 0xff7fffff, got %#x", v)
+	}
+	if v, _ := r.Read32(0x10); v != 0xffffffff {
+		t.Fatalf("Stuck bits should not affect the underlying memory, got %#x", v)
+	}
+	if s := f.Stats(); s != (FaultStats{Errors: 2}) {
+		t.Fatalf("Wrong stats: %+v", s)
+	}
+}
+
+func TestFaultInjector_random(t *testing.T) {
+	run := func() ([]uint64, FaultStats) {
+		r := NewRAM(psz, mirv.LittleEndian)
+		f := NewFaultInjector(r, FaultConfig{FlipRate: 0.5, ErrorRate: 0.1, DropRate: 0.2, Seed: 42})
+		var vs []uint64
+		for i := mirv.Address(0); i < 1000; i += 8 {
+			f.Write64(i, 0)
+			v, err := f.Read64(i)
+			if err != nil {
+				v = 42
+			} else if n := bits.OnesCount64(v); n > 1 {
+				t.Fatalf("Expected at most one bit flip, got %#x", v)
+			}
+			vs = append(vs, v)
+		}
+		return vs, f.Stats()
+	}
+	v0, s0 := run()
+	v1, s1 := run()
+	if s0 != s1 {
+		t.Fatalf("Runs with the same seed differ: %+v, %+v", s0, s1)
+	}
+	for i := range v0 {
+		if v0[i] != v1[i] {
+			t.Fatalf("Runs with the same seed differ at %d: %#x, %#x", i, v0[i], v1[i])
+		}
+	}
+	if s0.Flips == 0 || s0.Errors == 0 || s0.Drops == 0 {
+		t.Fatalf("Expected some faults, got %+v", s0)
+	}
+}
+
+func TestFaultInjector_checkpoint(t *testing.T) {
+	var b Bus
+	r := NewRAM(psz, mirv.BigEndian)
+	b.Map(psz, NewRAM(psz, mirv.BigEndian))
+	b.Map(psz*2, NewFaultInjector(r, FaultConfig{ErrorAddrs: []mirv.Address{0x10}}))
+	b.Write32(psz*2+4, 0xdeadbeef)
+	var e *ErrBus
+	if err := b.Write8(psz*2+0x10, 0); !errors.As(err, &e) || e.Addr != psz*2+0x10 || e.Size != 1 {
+		t.Fatalf("Expected injected bus error @ %#x, got %v", psz*2+0x10, err)
+	}
+	var buf bytes.Buffer
+	if err := b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b.Write32(psz*2+4, 0)
+	if err := b.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Read32(4); v != 0xdeadbeef {
+		t.Fatalf("Expected 0xdeadbeef, got %#x", v)
+	}
+}
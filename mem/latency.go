@@ -0,0 +1,73 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"github.com/db47h/mirv"
+)
+
+// Latency is an optional interface implemented by memory types with a non-zero
+// access latency, like slow flash memory or IO devices. When such memory is
+// mapped, the bus adds its latency to its wait cycles for each access.
+//
+type Latency interface {
+	Latency() (read, write uint64) // read and write latency in cycles
+}
+
+func latency(m Interface) (read, write uint64) {
+	if l, ok := m.(Latency); ok {
+		return l.Latency()
+	}
+	return 0, 0
+}
+
+// SetLatency sets the read and write latency in cycles of the memory block
+// containing addr. This overrides the latency declared by the mapped memory
+// Interface, if any. It returns an error if addr is not mapped.
+//
+// Memory latency has a noticeable performance impact on all memory accesses,
+// even when set to 0 for all but a few memory blocks.
+//
+func (b *Bus) SetLatency(addr mirv.Address, read, write uint64) error {
+	blk := b.memory(addr)
+	if blk == nilMemory {
+		return ErrUnmapped
+	}
+	blk.rl, blk.wl = read, write
+	b.updateHooks()
+	return nil
+}
+
+// WaitCycles returns the number of wait cycles accumulated by memory accesses
+// since the last call to WaitCycles and resets the count to 0. Wait cycles
+// come from memory latency and cache latency (see SetCache).
+//
+// CPU implementations should call this function after each instruction and
+// count the returned value against the budget of cycles passed to Step. Since
+// host accesses (like CopyIn, the ELF loader or debugger reads) also accumulate
+// wait cycles, they should also call it on entry to Step and on Reset and
+// discard the result.
+//
+func (b *Bus) WaitCycles() uint64 {
+	w := b.w
+	b.w = 0
+	return w
+}
@@ -0,0 +1,45 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+type slowMem struct {
+	Interface
+}
+
+func (slowMem) Latency() (read, write uint64) { return 3, 5 }
+
+func TestBus_SetLatency(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.LittleEndian))
+	b.Map(psz, slowMem{NewRAM(psz, mirv.LittleEndian)})
+
+	b.Read32(0)
+	b.Read32(psz)
+	b.Write8(psz, 0)
+	if w := b.WaitCycles(); w != 8 {
+		t.Fatalf("Expected 8 wait cycles, got %d", w)
+	}
+	if w := b.WaitCycles(); w != 0 {
+		t.Fatalf("Expected 0 wait cycles after reset, got %d", w)
+	}
+
+	if err := b.SetLatency(psz*2, 1, 1); err == nil {
+		t.Fatal("SetLatency succeeded on unmapped address")
+	}
+	if err := b.SetLatency(0, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetLatency(psz, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	b.Read32(0)
+	b.Write32(0, 0)
+	b.Read32(psz)
+	if w := b.WaitCycles(); w != 3 {
+		t.Fatalf("Expected 3 wait cycles, got %d", w)
+	}
+}
@@ -22,16 +22,14 @@
 //
 package mem
 
-import (
-	"errors"
-
-	"github.com/db47h/mirv"
-)
+import "github.com/db47h/mirv"
 
 // Type indicates the type of mapped memory.
 //
 type Type uint16
 
+//go:generate stringer -type Type
+
 // Memory type values.
 //
 const (
@@ -40,6 +38,12 @@ const (
 	MemIO               // Memory Mapped IO
 )
 
+// MarshalText implements encoding.TextMarshaler.
+//
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // Interface wraps the methods exported by types that can be used as memory.
 //
 // Address arguments are always specified relative to the beginning of the
@@ -93,16 +97,60 @@ func (NoMemory) Type() Type { return MemNone }
 //
 func (NoMemory) ByteOrder() mirv.ByteOrder { return 0 }
 
-var errPage = errors.New("Cross page memory access")
-
 // NewRAM returns a new RAM block of the requested size and byte order.
 //
 func NewRAM(size mirv.Address, byteOrder mirv.ByteOrder) Interface {
-	m := make([]uint8, size)
+	return newRAM(make([]uint8, size), byteOrder)
+}
+
+// newRAM returns a RAM block of the requested byte order backed by m.
+//
+func newRAM(m []uint8, byteOrder mirv.ByteOrder) Interface {
 	if byteOrder == mirv.LittleEndian {
 		return (*littleEndian)(&m)
 	}
 	return (*bigEndian)(&m)
 }
 
-//go:generate go run mem_gen.go -o mem_rw.go
+// NewView returns a new view of the RAM block m with the given byte order. The
+// returned Interface shares its backing memory with m, so that writes through
+// one are visible through the other. m must have been created by NewRAM or
+// NewView, otherwise NewView returns ErrNotRAM.
+//
+// Views can be mapped on separate buses in order to share memory between CPUs
+// of different byte orders, or swapped with Bus.Remap in order to implement
+// CPUs that can switch byte order at run time.
+//
+func NewView(m Interface, byteOrder mirv.ByteOrder) (Interface, error) {
+	p := ram(m)
+	if p == nil {
+		return nil, ErrNotRAM
+	}
+	if byteOrder == mirv.LittleEndian {
+		return (*littleEndian)(p), nil
+	}
+	return (*bigEndian)(p), nil
+}
+
+// Bytes returns the backing memory of a RAM block created by NewRAM or NewView.
+// It returns nil for any other Interface.
+//
+func Bytes(m Interface) []byte {
+	if p := ram(m); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// ram returns a pointer to the backing slice of a RAM block created by NewRAM
+// or NewView. It returns nil for any other Interface.
+//
+func ram(m Interface) *[]uint8 {
+	switch m := m.(type) {
+	case *littleEndian:
+		return (*[]uint8)(m)
+	case *bigEndian:
+		return (*[]uint8)(m)
+	}
+	return nil
+}
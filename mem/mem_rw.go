@@ -22,96 +22,141 @@ package mem
 
 import (
 	"encoding/binary"
+	"math/bits"
 
 	"github.com/db47h/mirv"
 )
 
-// big endian  memory interface
-type bigEndian []uint8
-
-func (m *bigEndian) Size() mirv.Address { return mirv.Address(len(*m)) }
-
-func (m *bigEndian) Type() Type { return MemRAM }
-
-func (m *bigEndian) ByteOrder() mirv.ByteOrder { return mirv.BigEndian }
-
-// Read8 returns the 8 bits big endian  value at address addr.
+// word is the set of types used for memory accesses. Supporting a new access
+// width is a matter of adding it to this set, implementing the corresponding
+// cases in the generic accessors below and adding the relevant methods to the
+// memory types.
 //
-func (m *bigEndian) Read8(addr mirv.Address) (uint8, error) {
-	if len((*m)[addr:]) < 1 {
-		return 0, errPage
-	}
-	return (*m)[addr], nil
+type word interface {
+	uint8 | uint16 | uint32 | uint64
 }
 
-// Write8 writes the 8 bits big endian  value to address addr.
+// sizeOf returns the size in bytes of T. This is a constant for any given
+// instance of T.
 //
-func (m *bigEndian) Write8(addr mirv.Address, v uint8) error {
-	if len((*m)[addr:]) < 1 {
-		return errPage
-	}
-	(*m)[addr] = v
-	return nil
+func sizeOf[T word]() uint8 {
+	return uint8(bits.Len64(uint64(^T(0))) / 8)
 }
 
-// Read16 returns the 16 bits big endian  value at address addr.
+// readLE returns the little endian value of type T at address addr in m.
 //
-func (m *bigEndian) Read16(addr mirv.Address) (uint16, error) {
-	if len((*m)[addr:]) < 2 {
-		return 0, errPage
+func readLE[T word](m []uint8, addr mirv.Address) (T, error) {
+	if m = m[addr:]; len(m) < int(sizeOf[T]()) {
+		return 0, ErrPage
+	}
+	switch sizeOf[T]() {
+	case 1:
+		return T(m[0]), nil
+	case 2:
+		return T(binary.LittleEndian.Uint16(m)), nil
+	case 4:
+		return T(binary.LittleEndian.Uint32(m)), nil
 	}
-	return binary.BigEndian.Uint16((*m)[addr:]), nil
+	return T(binary.LittleEndian.Uint64(m)), nil
 }
 
-// Write16 writes the 16 bits big endian  value to address addr.
+// writeLE writes the little endian value v of type T at address addr in m.
 //
-func (m *bigEndian) Write16(addr mirv.Address, v uint16) error {
-	if len((*m)[addr:]) < 2 {
-		return errPage
+func writeLE[T word](m []uint8, addr mirv.Address, v T) error {
+	if m = m[addr:]; len(m) < int(sizeOf[T]()) {
+		return ErrPage
+	}
+	switch sizeOf[T]() {
+	case 1:
+		m[0] = uint8(v)
+	case 2:
+		binary.LittleEndian.PutUint16(m, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(m, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(m, uint64(v))
 	}
-	binary.BigEndian.PutUint16((*m)[addr:], v)
 	return nil
 }
 
-// Read32 returns the 32 bits big endian  value at address addr.
+// readBE returns the big endian value of type T at address addr in m.
 //
-func (m *bigEndian) Read32(addr mirv.Address) (uint32, error) {
-	if len((*m)[addr:]) < 4 {
-		return 0, errPage
+func readBE[T word](m []uint8, addr mirv.Address) (T, error) {
+	if m = m[addr:]; len(m) < int(sizeOf[T]()) {
+		return 0, ErrPage
+	}
+	switch sizeOf[T]() {
+	case 1:
+		return T(m[0]), nil
+	case 2:
+		return T(binary.BigEndian.Uint16(m)), nil
+	case 4:
+		return T(binary.BigEndian.Uint32(m)), nil
 	}
-	return binary.BigEndian.Uint32((*m)[addr:]), nil
+	return T(binary.BigEndian.Uint64(m)), nil
 }
 
-// Write32 writes the 32 bits big endian  value to address addr.
+// writeBE writes the big endian value v of type T at address addr in m.
 //
-func (m *bigEndian) Write32(addr mirv.Address, v uint32) error {
-	if len((*m)[addr:]) < 4 {
-		return errPage
+func writeBE[T word](m []uint8, addr mirv.Address, v T) error {
+	if m = m[addr:]; len(m) < int(sizeOf[T]()) {
+		return ErrPage
+	}
+	switch sizeOf[T]() {
+	case 1:
+		m[0] = uint8(v)
+	case 2:
+		binary.BigEndian.PutUint16(m, uint16(v))
+	case 4:
+		binary.BigEndian.PutUint32(m, uint32(v))
+	default:
+		binary.BigEndian.PutUint64(m, uint64(v))
 	}
-	binary.BigEndian.PutUint32((*m)[addr:], v)
 	return nil
 }
 
-// Read64 returns the 64 bits big endian  value at address addr.
+// big endian memory interface
+type bigEndian []uint8
+
+func (m *bigEndian) Size() mirv.Address { return mirv.Address(len(*m)) }
+
+func (m *bigEndian) Type() Type { return MemRAM }
+
+func (m *bigEndian) ByteOrder() mirv.ByteOrder { return mirv.BigEndian }
+
+// Read8 returns the 8 bits value at address addr.
 //
-func (m *bigEndian) Read64(addr mirv.Address) (uint64, error) {
-	if len((*m)[addr:]) < 8 {
-		return 0, errPage
-	}
-	return binary.BigEndian.Uint64((*m)[addr:]), nil
-}
+func (m *bigEndian) Read8(addr mirv.Address) (uint8, error) { return readBE[uint8](*m, addr) }
 
-// Write64 writes the 64 bits big endian  value to address addr.
+// Write8 writes the 8 bits value to address addr.
 //
-func (m *bigEndian) Write64(addr mirv.Address, v uint64) error {
-	if len((*m)[addr:]) < 8 {
-		return errPage
-	}
-	binary.BigEndian.PutUint64((*m)[addr:], v)
-	return nil
-}
+func (m *bigEndian) Write8(addr mirv.Address, v uint8) error { return writeBE(*m, addr, v) }
+
+// Read16 returns the 16 bits big endian value at address addr.
+//
+func (m *bigEndian) Read16(addr mirv.Address) (uint16, error) { return readBE[uint16](*m, addr) }
+
+// Write16 writes the 16 bits big endian value to address addr.
+//
+func (m *bigEndian) Write16(addr mirv.Address, v uint16) error { return writeBE(*m, addr, v) }
+
+// Read32 returns the 32 bits big endian value at address addr.
+//
+func (m *bigEndian) Read32(addr mirv.Address) (uint32, error) { return readBE[uint32](*m, addr) }
+
+// Write32 writes the 32 bits big endian value to address addr.
+//
+func (m *bigEndian) Write32(addr mirv.Address, v uint32) error { return writeBE(*m, addr, v) }
+
+// Read64 returns the 64 bits big endian value at address addr.
+//
+func (m *bigEndian) Read64(addr mirv.Address) (uint64, error) { return readBE[uint64](*m, addr) }
+
+// Write64 writes the 64 bits big endian value to address addr.
+//
+func (m *bigEndian) Write64(addr mirv.Address, v uint64) error { return writeBE(*m, addr, v) }
 
-// little endian  memory interface
+// little endian memory interface
 type littleEndian []uint8
 
 func (m *littleEndian) Size() mirv.Address { return mirv.Address(len(*m)) }
@@ -120,126 +165,82 @@ func (m *littleEndian) Type() Type { return MemRAM }
 
 func (m *littleEndian) ByteOrder() mirv.ByteOrder { return mirv.LittleEndian }
 
-// Read8 returns the 8 bits little endian  value at address addr.
+// Read8 returns the 8 bits value at address addr.
 //
-func (m *littleEndian) Read8(addr mirv.Address) (uint8, error) {
-	if len((*m)[addr:]) < 1 {
-		return 0, errPage
-	}
-	return (*m)[addr], nil
-}
+func (m *littleEndian) Read8(addr mirv.Address) (uint8, error) { return readLE[uint8](*m, addr) }
 
-// Write8 writes the 8 bits little endian  value to address addr.
+// Write8 writes the 8 bits value to address addr.
 //
-func (m *littleEndian) Write8(addr mirv.Address, v uint8) error {
-	if len((*m)[addr:]) < 1 {
-		return errPage
-	}
-	(*m)[addr] = v
-	return nil
-}
+func (m *littleEndian) Write8(addr mirv.Address, v uint8) error { return writeLE(*m, addr, v) }
 
-// Read16 returns the 16 bits little endian  value at address addr.
+// Read16 returns the 16 bits little endian value at address addr.
 //
-func (m *littleEndian) Read16(addr mirv.Address) (uint16, error) {
-	if len((*m)[addr:]) < 2 {
-		return 0, errPage
-	}
-	return binary.LittleEndian.Uint16((*m)[addr:]), nil
-}
+func (m *littleEndian) Read16(addr mirv.Address) (uint16, error) { return readLE[uint16](*m, addr) }
 
-// Write16 writes the 16 bits little endian  value to address addr.
+// Write16 writes the 16 bits little endian value to address addr.
 //
-func (m *littleEndian) Write16(addr mirv.Address, v uint16) error {
-	if len((*m)[addr:]) < 2 {
-		return errPage
-	}
-	binary.LittleEndian.PutUint16((*m)[addr:], v)
-	return nil
-}
+func (m *littleEndian) Write16(addr mirv.Address, v uint16) error { return writeLE(*m, addr, v) }
 
-// Read32 returns the 32 bits little endian  value at address addr.
+// Read32 returns the 32 bits little endian value at address addr.
 //
-func (m *littleEndian) Read32(addr mirv.Address) (uint32, error) {
-	if len((*m)[addr:]) < 4 {
-		return 0, errPage
-	}
-	return binary.LittleEndian.Uint32((*m)[addr:]), nil
-}
+func (m *littleEndian) Read32(addr mirv.Address) (uint32, error) { return readLE[uint32](*m, addr) }
 
-// Write32 writes the 32 bits little endian  value to address addr.
+// Write32 writes the 32 bits little endian value to address addr.
 //
-func (m *littleEndian) Write32(addr mirv.Address, v uint32) error {
-	if len((*m)[addr:]) < 4 {
-		return errPage
-	}
-	binary.LittleEndian.PutUint32((*m)[addr:], v)
-	return nil
-}
+func (m *littleEndian) Write32(addr mirv.Address, v uint32) error { return writeLE(*m, addr, v) }
 
-// Read64 returns the 64 bits little endian  value at address addr.
+// Read64 returns the 64 bits little endian value at address addr.
 //
-func (m *littleEndian) Read64(addr mirv.Address) (uint64, error) {
-	if len((*m)[addr:]) < 8 {
-		return 0, errPage
-	}
-	return binary.LittleEndian.Uint64((*m)[addr:]), nil
-}
+func (m *littleEndian) Read64(addr mirv.Address) (uint64, error) { return readLE[uint64](*m, addr) }
 
-// Write64 writes the 64 bits little endian  value to address addr.
+// Write64 writes the 64 bits little endian value to address addr.
 //
-func (m *littleEndian) Write64(addr mirv.Address, v uint64) error {
-	if len((*m)[addr:]) < 8 {
-		return errPage
-	}
-	binary.LittleEndian.PutUint64((*m)[addr:], v)
-	return nil
-}
+func (m *littleEndian) Write64(addr mirv.Address, v uint64) error { return writeLE(*m, addr, v) }
 
 // Read8 always returns 0 and an error of type *ErrBus.
 //
-func (NoMemory) Read8(addr mirv.Address) (uint8, error) {
-	return 0, errBus(opRead, 1, addr)
-}
+func (NoMemory) Read8(addr mirv.Address) (uint8, error) { return 0, errBus(OpRead, 1, addr) }
 
 // Write8 always returns an error of type *ErrBus.
 //
-func (NoMemory) Write8(addr mirv.Address, v uint8) error {
-	return errBus(opWrite, 1, addr)
-}
+func (NoMemory) Write8(addr mirv.Address, v uint8) error { return errBus(OpWrite, 1, addr) }
 
 // Read16 always returns 0 and an error of type *ErrBus.
 //
-func (NoMemory) Read16(addr mirv.Address) (uint16, error) {
-	return 0, errBus(opRead, 2, addr)
-}
+func (NoMemory) Read16(addr mirv.Address) (uint16, error) { return 0, errBus(OpRead, 2, addr) }
 
 // Write16 always returns an error of type *ErrBus.
 //
-func (NoMemory) Write16(addr mirv.Address, v uint16) error {
-	return errBus(opWrite, 2, addr)
-}
+func (NoMemory) Write16(addr mirv.Address, v uint16) error { return errBus(OpWrite, 2, addr) }
 
 // Read32 always returns 0 and an error of type *ErrBus.
 //
-func (NoMemory) Read32(addr mirv.Address) (uint32, error) {
-	return 0, errBus(opRead, 4, addr)
-}
+func (NoMemory) Read32(addr mirv.Address) (uint32, error) { return 0, errBus(OpRead, 4, addr) }
 
 // Write32 always returns an error of type *ErrBus.
 //
-func (NoMemory) Write32(addr mirv.Address, v uint32) error {
-	return errBus(opWrite, 4, addr)
-}
+func (NoMemory) Write32(addr mirv.Address, v uint32) error { return errBus(OpWrite, 4, addr) }
 
 // Read64 always returns 0 and an error of type *ErrBus.
 //
-func (NoMemory) Read64(addr mirv.Address) (uint64, error) {
-	return 0, errBus(opRead, 8, addr)
-}
+func (NoMemory) Read64(addr mirv.Address) (uint64, error) { return 0, errBus(OpRead, 8, addr) }
 
 // Write64 always returns an error of type *ErrBus.
 //
-func (NoMemory) Write64(addr mirv.Address, v uint64) error {
-	return errBus(opWrite, 8, addr)
+func (NoMemory) Write64(addr mirv.Address, v uint64) error { return errBus(OpWrite, 8, addr) }
+
+// unmapped is the memory of nilMemory. It behaves like NoMemory but its bus
+// errors wrap ErrUnmapped.
+//
+type unmapped struct {
+	NoMemory
 }
+
+func (unmapped) Read8(addr mirv.Address) (uint8, error)    { return 0, errUnmapped(OpRead, 1, addr) }
+func (unmapped) Write8(addr mirv.Address, v uint8) error   { return errUnmapped(OpWrite, 1, addr) }
+func (unmapped) Read16(addr mirv.Address) (uint16, error)  { return 0, errUnmapped(OpRead, 2, addr) }
+func (unmapped) Write16(addr mirv.Address, v uint16) error { return errUnmapped(OpWrite, 2, addr) }
+func (unmapped) Read32(addr mirv.Address) (uint32, error)  { return 0, errUnmapped(OpRead, 4, addr) }
+func (unmapped) Write32(addr mirv.Address, v uint32) error { return errUnmapped(OpWrite, 4, addr) }
+func (unmapped) Read64(addr mirv.Address) (uint64, error)  { return 0, errUnmapped(OpRead, 8, addr) }
+func (unmapped) Write64(addr mirv.Address, v uint64) error { return errUnmapped(OpWrite, 8, addr) }
@@ -1,6 +1,7 @@
 package mem_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/db47h/mirv"
@@ -19,3 +20,138 @@ func BenchmarkBus_Write64(b *testing.B) {
 		}
 	}
 }
+
+func TestNewView(t *testing.T) {
+	var le, be mem.Bus
+	r := mem.NewRAM(psz, mirv.LittleEndian)
+	v, err := mem.NewView(r, mirv.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ByteOrder() != mirv.BigEndian || v.Size() != r.Size() {
+		t.Fatalf("Bad view: byte order %d, size %d", v.ByteOrder(), v.Size())
+	}
+	le.Map(0, r)
+	be.Map(0x8000, v)
+	le.Write32(16, 0x12345678)
+	if x, err := be.Read32(0x8000 + 16); err != nil || x != 0x78563412 {
+		t.Fatalf("Expected 0x78563412, got %x, %v", x, err)
+	}
+	be.Write16(0x8000, 0xbeef)
+	if x, err := le.Read16(0); err != nil || x != 0xefbe {
+		t.Fatalf("Expected 0xefbe, got %x, %v", x, err)
+	}
+	if _, err = mem.NewView(mem.NoMemory{}, mirv.BigEndian); err != mem.ErrNotRAM {
+		t.Fatal("NewView succeeded on non RAM memory")
+	}
+}
+
+func benchBus(b *testing.B, byteOrder mirv.ByteOrder, f func(bus *mem.Bus, addr mirv.Address) error) {
+	var bus mem.Bus
+	bus.Map(0, mem.NewRAM(psz, byteOrder))
+	bus.Map(psz, mem.NewRAM(psz, byteOrder))
+	for i := 0; i < b.N; i++ {
+		if err := f(&bus, mirv.Address(i&(psz-8))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBus(b *testing.B) {
+	for _, bo := range []mirv.ByteOrder{mirv.LittleEndian, mirv.BigEndian} {
+		name := "LE"
+		if bo == mirv.BigEndian {
+			name = "BE"
+		}
+		b.Run("Read8"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { _, err := bus.Read8(addr); return err })
+		})
+		b.Run("Write8"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { return bus.Write8(addr, 42) })
+		})
+		b.Run("Read16"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { _, err := bus.Read16(addr); return err })
+		})
+		b.Run("Write16"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { return bus.Write16(addr, 42) })
+		})
+		b.Run("Read32"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { _, err := bus.Read32(addr); return err })
+		})
+		b.Run("Write32"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { return bus.Write32(addr, 42) })
+		})
+		b.Run("Read64"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { _, err := bus.Read64(addr); return err })
+		})
+		b.Run("Write64"+name, func(b *testing.B) {
+			benchBus(b, bo, func(bus *mem.Bus, addr mirv.Address) error { return bus.Write64(addr, 42) })
+		})
+	}
+}
+
+// BenchmarkBus_slow measures the slow path of Bus accesses: accesses to a
+// block other than the preferred one and accesses with hooks enabled.
+func BenchmarkBus_slow(b *testing.B) {
+	for _, d := range []struct {
+		name   string
+		base   mirv.Address
+		hooked bool
+	}{
+		{"Other", psz, false},
+		{"Hooked", 0, true},
+	} {
+		bench := func(f func(bus *mem.Bus, addr mirv.Address) error) func(*testing.B) {
+			return func(b *testing.B) {
+				var bus mem.Bus
+				bus.Map(0, mem.NewRAM(psz, mirv.LittleEndian))
+				bus.Map(psz, mem.NewRAM(psz, mirv.LittleEndian))
+				bus.SetStats(d.hooked)
+				for i := 0; i < b.N; i++ {
+					if err := f(&bus, d.base+mirv.Address(i&(psz-8))); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		}
+		b.Run("Read8"+d.name, bench(func(bus *mem.Bus, addr mirv.Address) error { _, err := bus.Read8(addr); return err }))
+		b.Run("Write8"+d.name, bench(func(bus *mem.Bus, addr mirv.Address) error { return bus.Write8(addr, 42) }))
+		b.Run("Read32"+d.name, bench(func(bus *mem.Bus, addr mirv.Address) error { _, err := bus.Read32(addr); return err }))
+		b.Run("Write32"+d.name, bench(func(bus *mem.Bus, addr mirv.Address) error { return bus.Write32(addr, 42) }))
+	}
+}
+
+func TestBus_Slice(t *testing.T) {
+	var b mem.Bus
+	r := mem.NewRAM(psz, mirv.BigEndian)
+	b.Map(psz, r)
+	b.Map(psz*2, &ioMem{mem.NewRAM(psz, mirv.BigEndian)})
+	if !bytes.Equal(mem.Bytes(r), make([]byte, psz)) {
+		t.Fatal("Bytes returned wrong slice")
+	}
+	base, p := b.Slice(psz + 42)
+	if base != psz || len(p) != psz {
+		t.Fatalf("Expected %d bytes at %#x, got %d bytes at %#x", psz, psz, len(p), base)
+	}
+	p[43] = 0x42
+	if v, _ := b.Read16(psz + 42); v != 0x42 {
+		t.Fatalf("Expected 0x42, got %#x", v)
+	}
+	if _, p := b.Slice(psz * 2); p != nil {
+		t.Fatal("Slice returned non nil slice for IO memory")
+	}
+	if _, p := b.Slice(0); p != nil {
+		t.Fatal("Slice returned non nil slice for unmapped memory")
+	}
+	if b.Hooked() {
+		t.Fatal("Hooked returned true with no hooks enabled")
+	}
+	b.SetStats(true)
+	if !b.Hooked() {
+		t.Fatal("Hooked returned false with stats enabled")
+	}
+	b.SetStats(false)
+	if b.Hooked() {
+		t.Fatal("Hooked returned true after disabling stats")
+	}
+}
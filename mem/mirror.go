@@ -0,0 +1,147 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"errors"
+	"io"
+
+	"github.com/db47h/mirv"
+)
+
+var errMirrorSize = errors.New("mirror of zero size")
+
+// mirror is the Interface returned by NewMirror.
+//
+type mirror struct {
+	m    Interface
+	n    mirv.Address // number of repeats
+	mask mirv.Address
+}
+
+// NewMirror returns a memory Interface that repeats the memory block m n times
+// in a row. The returned Interface has the same type and byte order as m and
+// its size is m.Size() * n. It returns an error if n or the size of m is 0, or
+// if the size of the mirror overflows the address space.
+//
+// For each access, the address relative to the start of the mirror is first
+// masked with mask, then wrapped around m.Size(). Use a mask of ^mirv.Address(0)
+// to simply repeat m. The mask can be used to emulate incompletely decoded
+// peripherals that ignore some address bits:
+//
+//	// a 256 bytes register file mirrored over a 4KiB window, ignoring
+//	// address bit 7 (i.e. the registers at offsets 0x80-0xff are not
+//	// accessible).
+//	m, err := mem.NewMirror(regs, 16, ^mirv.Address(0x80))
+//	if err != nil {
+//		// handle error
+//	}
+//	bus.Map(0xf0000000, m)
+//
+// A mirror of a RAM block can also be used to map the same RAM at several
+// addresses with a single Map call.
+//
+// Mirrors forward the memory latency of m (see Latency). They implement
+// Serializer by saving and loading the contents of m if m is a RAM block, or
+// its state if m implements Serializer.
+//
+func NewMirror(m Interface, n mirv.Address, mask mirv.Address) (Interface, error) {
+	sz := m.Size()
+	switch {
+	case n == 0 || sz == 0:
+		return nil, errMirrorSize
+	case sz*n/n != sz:
+		return nil, ErrOverflow
+	}
+	return &mirror{m, n, mask}, nil
+}
+
+func (m *mirror) addr(addr mirv.Address) mirv.Address {
+	return (addr & m.mask) % m.m.Size()
+}
+
+func (m *mirror) Size() mirv.Address { return m.m.Size() * m.n }
+
+func (m *mirror) Type() Type { return m.m.Type() }
+
+func (m *mirror) ByteOrder() mirv.ByteOrder { return m.m.ByteOrder() }
+
+// Latency implements Latency.
+//
+func (m *mirror) Latency() (read, write uint64) { return latency(m.m) }
+
+// Read8 returns the 8 bits value at address addr.
+//
+func (m *mirror) Read8(addr mirv.Address) (uint8, error) { return m.m.Read8(m.addr(addr)) }
+
+// Write8 writes the 8 bits value to address addr.
+//
+func (m *mirror) Write8(addr mirv.Address, v uint8) error { return m.m.Write8(m.addr(addr), v) }
+
+// Read16 returns the 16 bits value at address addr.
+//
+func (m *mirror) Read16(addr mirv.Address) (uint16, error) { return m.m.Read16(m.addr(addr)) }
+
+// Write16 writes the 16 bits value to address addr.
+//
+func (m *mirror) Write16(addr mirv.Address, v uint16) error { return m.m.Write16(m.addr(addr), v) }
+
+// Read32 returns the 32 bits value at address addr.
+//
+func (m *mirror) Read32(addr mirv.Address) (uint32, error) { return m.m.Read32(m.addr(addr)) }
+
+// Write32 writes the 32 bits value to address addr.
+//
+func (m *mirror) Write32(addr mirv.Address, v uint32) error { return m.m.Write32(m.addr(addr), v) }
+
+// Read64 returns the 64 bits value at address addr.
+//
+func (m *mirror) Read64(addr mirv.Address) (uint64, error) { return m.m.Read64(m.addr(addr)) }
+
+// Write64 writes the 64 bits value to address addr.
+//
+func (m *mirror) Write64(addr mirv.Address, v uint64) error { return m.m.Write64(m.addr(addr), v) }
+
+// Save implements Serializer.
+//
+func (m *mirror) Save(w io.Writer) error {
+	if p := ram(m.m); p != nil {
+		_, err := w.Write(*p)
+		return err
+	}
+	if sr, ok := m.m.(Serializer); ok {
+		return sr.Save(w)
+	}
+	return nil
+}
+
+// Load implements Serializer.
+//
+func (m *mirror) Load(r io.Reader) error {
+	if p := ram(m.m); p != nil {
+		_, err := io.ReadFull(r, *p)
+		return err
+	}
+	if sr, ok := m.m.(Serializer); ok {
+		return sr.Load(r)
+	}
+	return nil
+}
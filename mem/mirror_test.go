@@ -0,0 +1,90 @@
+package mem
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+// newMirror returns a new mirror or fails the test.
+func newMirror(t *testing.T, m Interface, n, mask mirv.Address) Interface {
+	t.Helper()
+	mr, err := NewMirror(m, n, mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mr
+}
+
+func TestNewMirror(t *testing.T) {
+	var b Bus
+	r := NewRAM(256, mirv.LittleEndian)
+	if err := b.Map(psz, newMirror(t, r, 4, ^mirv.Address(0))); err != nil {
+		t.Fatal(err)
+	}
+	if _, m := b.Memory(psz); m.Size() != 1024 || m.Type() != MemRAM || m.ByteOrder() != mirv.LittleEndian {
+		t.Fatalf("Wrong mirror size, type or byte order: %d, %v, %v", m.Size(), m.Type(), m.ByteOrder())
+	}
+	b.Write32(psz+0x304, 0xdeadbeef)
+	for i := mirv.Address(0); i < 4; i++ {
+		if v, _ := b.Read32(psz + i*256 + 4); v != 0xdeadbeef {
+			t.Fatalf("Expected 0xdeadbeef at %#x, got %#x", psz+i*256+4, v)
+		}
+	}
+	if v, _ := r.Read32(4); v != 0xdeadbeef {
+		t.Fatalf("Expected 0xdeadbeef in mirrored RAM, got %#x", v)
+	}
+	if _, err := b.Read8(psz + 1024); err == nil {
+		t.Fatal("Read past the end of the mirror succeeded")
+	}
+
+	b.Map(psz*3, newMirror(t, slowMem{r}, 2, ^mirv.Address(0)))
+	b.Write8(psz*3, 0)
+	if w := b.WaitCycles(); w != 5 {
+		t.Fatalf("Expected 5 wait cycles, got %d", w)
+	}
+
+	// ignore address bits 2 and 3
+	b.Map(psz*2, newMirror(t, r, 1, ^mirv.Address(0x0c)))
+	b.Write8(psz*2+0x1c, 0x42)
+	if v, _ := r.Read8(0x10); v != 0x42 {
+		t.Fatalf("Expected 0x42 at 0x10, got %#x", v)
+	}
+}
+
+func TestNewMirror_checkpoint(t *testing.T) {
+	var b Bus
+	r := NewRAM(256, mirv.BigEndian)
+	b.Map(0, newMirror(t, r, 2, ^mirv.Address(0)))
+	b.Write64(8, 0x0102030405060708)
+	var buf bytes.Buffer
+	if err := b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b.Write64(8, 0)
+	if err := b.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := b.Read64(264); v != 0x0102030405060708 {
+		t.Fatalf("Expected 0x0102030405060708, got %#x", v)
+	}
+}
+
+func TestNewMirror_invalid(t *testing.T) {
+	r := NewRAM(256, mirv.LittleEndian)
+	for _, d := range []struct {
+		name string
+		m    Interface
+		n    mirv.Address
+		err  error
+	}{
+		{"zero repeats", r, 0, errMirrorSize},
+		{"zero size", NewRAM(0, mirv.LittleEndian), 4, errMirrorSize},
+		{"overflow", r, 1 << 56, ErrOverflow},
+	} {
+		if m, err := NewMirror(d.m, d.n, ^mirv.Address(0)); err != d.err || m != nil {
+			t.Errorf("%s: expected error %v, got %v, %v", d.name, d.err, m, err)
+		}
+	}
+}
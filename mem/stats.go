@@ -0,0 +1,161 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"text/tabwriter"
+
+	"github.com/db47h/mirv"
+)
+
+// Stats holds the access counters of a mapped memory block. Counters are
+// indexed by access width: 8, 16, 32 and 64 bits. Instruction fetches are
+// counted as reads.
+//
+type Stats struct {
+	Reads  [4]uint64 `json:"reads"`
+	Writes [4]uint64 `json:"writes"`
+}
+
+func (s *Stats) count(op Op, size uint8) {
+	i := bits.TrailingZeros8(size)
+	if op != OpWrite {
+		s.Reads[i]++
+	} else {
+		s.Writes[i]++
+	}
+}
+
+// Accesses returns the total number of reads and writes.
+//
+func (s *Stats) Accesses() uint64 {
+	var n uint64
+	for i := range s.Reads {
+		n += s.Reads[i] + s.Writes[i]
+	}
+	return n
+}
+
+// Bytes returns the number of bytes read and written.
+//
+func (s *Stats) Bytes() (read, written uint64) {
+	for i := range s.Reads {
+		read += s.Reads[i] << uint(i)
+		written += s.Writes[i] << uint(i)
+	}
+	return read, written
+}
+
+// BlockStats holds the access statistics of a mapped memory block.
+//
+type BlockStats struct {
+	Start      mirv.Address `json:"start"`
+	End        mirv.Address `json:"end"` // last address of the block
+	Type       Type         `json:"type"`
+	Preferred  bool         `json:"preferred"` // true if this is the preferred block
+	ReadBytes  uint64       `json:"readBytes"`
+	WriteBytes uint64       `json:"writeBytes"`
+	Stats
+}
+
+// SetStats enables or disables the collection of access statistics for all
+// mapped blocks, including blocks mapped later on. Enabling statistics resets
+// all counters.
+//
+// Collecting statistics has a noticeable performance impact on all memory
+// accesses and should only be enabled for profiling purposes.
+//
+func (b *Bus) SetStats(enable bool) {
+	b.stats = enable
+	for _, blk := range b.blocks() {
+		if enable {
+			blk.st = new(Stats)
+		} else {
+			blk.st = nil
+		}
+	}
+	b.updateHooks()
+}
+
+// Stats returns the access statistics for all mapped blocks in address order.
+// It returns nil if statistics are disabled.
+//
+func (b *Bus) Stats() []BlockStats {
+	if !b.stats {
+		return nil
+	}
+	var bs []BlockStats
+	for _, blk := range b.blocks() {
+		r, w := blk.st.Bytes()
+		bs = append(bs, BlockStats{
+			Start:      blk.s,
+			End:        blk.e,
+			Type:       blk.m.Type(),
+			Preferred:  blk == b.p,
+			ReadBytes:  r,
+			WriteBytes: w,
+			Stats:      *blk.st,
+		})
+	}
+	return bs
+}
+
+// WriteStats writes the access statistics for all mapped blocks as a text
+// table. The last column shows the share of each block in the total number of
+// accesses, making it easy to spot hot blocks. The preferred block is marked
+// with a '*'.
+//
+func (b *Bus) WriteStats(w io.Writer) error {
+	var total uint64
+	bs := b.Stats()
+	for i := range bs {
+		total += bs[i].Accesses()
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "start\tend\ttype\tR8\tR16\tR32\tR64\tW8\tW16\tW32\tW64\tread bytes\twritten bytes\tshare\t")
+	for i := range bs {
+		s := &bs[i]
+		var pref, share string
+		if s.Preferred {
+			pref = "*"
+		}
+		if total != 0 {
+			share = fmt.Sprintf("%.2f%%", float64(s.Accesses())*100/float64(total))
+		}
+		fmt.Fprintf(tw, "%#x\t%#x\t%s%v\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+			s.Start, s.End, pref, s.Type,
+			s.Reads[0], s.Reads[1], s.Reads[2], s.Reads[3],
+			s.Writes[0], s.Writes[1], s.Writes[2], s.Writes[3],
+			s.ReadBytes, s.WriteBytes, share)
+	}
+	return tw.Flush()
+}
+
+// WriteStatsJSON writes the access statistics for all mapped blocks as a JSON
+// array of BlockStats.
+//
+func (b *Bus) WriteStatsJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(b.Stats())
+}
@@ -0,0 +1,68 @@
+package mem
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestBus_Stats(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.LittleEndian))
+	b.Map(psz, NewRAM(psz, mirv.LittleEndian))
+
+	if s := b.Stats(); s != nil {
+		t.Fatalf("Stats should be nil when disabled, got %v", s)
+	}
+	b.SetStats(true)
+	// mapped after enabling stats
+	b.Map(psz*4, NewRAM(psz, mirv.LittleEndian))
+
+	b.Write32(0, 1)
+	b.Read32(0)
+	b.Read8(psz)
+	b.Read8(psz + 1)
+	b.Write64(psz*4, 42)
+	b.Read8(psz * 8) // unmapped
+
+	s := b.Stats()
+	if len(s) != 3 {
+		t.Fatalf("Expected stats for 3 blocks, got %d", len(s))
+	}
+	if !s[0].Preferred || s[0].Reads[2] != 1 || s[0].Writes[2] != 1 || s[0].ReadBytes != 4 || s[0].WriteBytes != 4 {
+		t.Fatalf("Bad stats for block 0: %+v", s[0])
+	}
+	if s[1].Reads[0] != 2 || s[1].Accesses() != 2 {
+		t.Fatalf("Bad stats for block 1: %+v", s[1])
+	}
+	if s[2].Start != psz*4 || s[2].Writes[3] != 1 || s[2].WriteBytes != 8 {
+		t.Fatalf("Bad stats for block 2: %+v", s[2])
+	}
+
+	var buf bytes.Buffer
+	if err := b.WriteStats(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 4 {
+		t.Fatalf("Expected 4 lines of output, got:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := b.WriteStatsJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var js []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &js); err != nil || len(js) != 3 {
+		t.Fatalf("Bad JSON output: %v\n%s", err, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"type":"MemRAM"`) {
+		t.Fatalf("Unexpected JSON output: %s", buf.String())
+	}
+
+	b.SetStats(false)
+	if s := b.Stats(); s != nil {
+		t.Fatalf("Stats should be nil when disabled, got %v", s)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/db47h/mirv"
+)
+
+// trace file header
+var traceMagic = []byte("MIRVTRC1")
+
+var errTraceFormat = errors.New("invalid trace format")
+
+// trace record flags
+const (
+	trSizeMask = 0x03 // log2 of the access size
+	trWrite    = 0x04 // write access
+	trError    = 0x08 // access failed
+	trUnmapped = 0x10 // unmapped address
+	trFetch    = 0x20 // instruction fetch
+)
+
+// Tracer records bus accesses to an io.Writer in a compact binary format.
+// Use a TraceReader or DecodeTrace to read it back.
+//
+// Each record is made of a flags byte (access size, direction, instruction
+// fetch, error and unmapped address flags) followed by the uvarint encoded cycle delta since
+// the previous record, address, value and offset of the address relative to
+// the target block.
+//
+type Tracer struct {
+	w     *bufio.Writer
+	clock func() uint64
+	cycle uint64
+	err   error
+	buf   [1 + 4*binary.MaxVarintLen64]byte
+}
+
+// NewTracer returns a new Tracer writing to w. The clock function is called
+// for every access and should return the current cycle count of the
+// simulation. If clock is nil, records are numbered sequentially.
+//
+// The Tracer does its own buffering; call Flush when done.
+//
+func NewTracer(w io.Writer, clock func() uint64) *Tracer {
+	t := &Tracer{w: bufio.NewWriter(w), clock: clock}
+	_, t.err = t.w.Write(traceMagic)
+	return t
+}
+
+func (t *Tracer) record(blk *block, op Op, size uint8, addr mirv.Address, v uint64, err error) {
+	if t.err != nil {
+		return
+	}
+	var c uint64
+	if t.clock != nil {
+		c = t.clock()
+	} else {
+		c = t.cycle + 1
+	}
+	f := byte(bits.TrailingZeros8(size))
+	switch op {
+	case OpWrite:
+		f |= trWrite
+	case OpFetch:
+		f |= trFetch
+	}
+	if err != nil {
+		f |= trError
+	}
+	if blk == nilMemory {
+		f |= trUnmapped
+	}
+	t.buf[0] = f
+	n := 1
+	n += binary.PutUvarint(t.buf[n:], c-t.cycle)
+	n += binary.PutUvarint(t.buf[n:], uint64(addr))
+	n += binary.PutUvarint(t.buf[n:], v)
+	if blk != nilMemory {
+		n += binary.PutUvarint(t.buf[n:], uint64(addr-blk.s))
+	}
+	t.cycle = c
+	_, t.err = t.w.Write(t.buf[:n])
+}
+
+// Flush writes any buffered data to the underlying io.Writer. It returns the
+// first error encountered while writing the trace, if any.
+//
+func (t *Tracer) Flush() error {
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
+
+// SetTracer enables bus access tracing with the given Tracer. Tracing is
+// disabled if t is nil.
+//
+func (b *Bus) SetTracer(t *Tracer) {
+	b.tr = t
+	b.updateHooks()
+}
+
+// TraceRecord describes a single bus access.
+//
+type TraceRecord struct {
+	Cycle    uint64
+	Addr     mirv.Address
+	Base     mirv.Address // base address of the target block
+	Value    uint64       // value read or written
+	Size     uint8        // access size in bytes
+	Write    bool         // true for writes
+	Fetch    bool         // true for instruction fetches
+	Err      bool         // true if the access failed
+	Unmapped bool         // true if Addr is not mapped, Base is not valid
+}
+
+func (r *TraceRecord) String() string {
+	var (
+		dir  = 'R'
+		stat string
+	)
+	if r.Write {
+		dir = 'W'
+	} else if r.Fetch {
+		dir = 'X'
+	}
+	switch {
+	case r.Unmapped:
+		stat = " unmapped"
+	case r.Err:
+		stat = fmt.Sprintf(" [%#x] error", r.Base)
+	default:
+		stat = fmt.Sprintf(" [%#x]", r.Base)
+	}
+	return fmt.Sprintf("%d: %c%d @ %#x = %#0*x%s", r.Cycle, dir, r.Size*8, r.Addr, r.Size*2, r.Value, stat)
+}
+
+// TraceReader decodes a bus trace written by a Tracer.
+//
+type TraceReader struct {
+	r     *bufio.Reader
+	cycle uint64
+}
+
+// NewTraceReader returns a new TraceReader reading from r.
+//
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	br := bufio.NewReader(r)
+	var hdr [8]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:], traceMagic) {
+		return nil, errTraceFormat
+	}
+	return &TraceReader{r: br}, nil
+}
+
+// Next returns the next record in the trace. It returns io.EOF when there are
+// no more records.
+//
+func (t *TraceReader) Next() (TraceRecord, error) {
+	var (
+		r   TraceRecord
+		off uint64
+	)
+	f, err := t.r.ReadByte()
+	if err != nil {
+		return r, err
+	}
+	d, err := binary.ReadUvarint(t.r)
+	if err == nil {
+		var a uint64
+		a, err = binary.ReadUvarint(t.r)
+		r.Addr = mirv.Address(a)
+	}
+	if err == nil {
+		r.Value, err = binary.ReadUvarint(t.r)
+	}
+	if err == nil && f&trUnmapped == 0 {
+		off, err = binary.ReadUvarint(t.r)
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return r, err
+	}
+	t.cycle += d
+	r.Cycle = t.cycle
+	r.Base = r.Addr - mirv.Address(off)
+	r.Size = 1 << (f & trSizeMask)
+	r.Write = f&trWrite != 0
+	r.Fetch = f&trFetch != 0
+	r.Err = f&trError != 0
+	r.Unmapped = f&trUnmapped != 0
+	return r, nil
+}
+
+// DecodeTrace reads a binary bus trace from r and writes it to w in text
+// form, one record per line.
+//
+func DecodeTrace(w io.Writer, r io.Reader) error {
+	tr, err := NewTraceReader(r)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintln(bw, rec.String()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package mem
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestBus_SetTracer(t *testing.T) {
+	var (
+		b     Bus
+		buf   bytes.Buffer
+		cycle uint64
+	)
+	b.Map(0x1000, NewRAM(psz, mirv.LittleEndian))
+	tr := NewTracer(&buf, func() uint64 { cycle += 3; return cycle })
+	b.SetTracer(tr)
+	b.Write32(0x1004, 0xdeadbeef)
+	b.Read16(0x1006)
+	b.Read8(0x10)
+	b.SetTracer(nil)
+	b.Read8(0x1000) // not traced
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []TraceRecord{
+		{Cycle: 3, Addr: 0x1004, Base: 0x1000, Value: 0xdeadbeef, Size: 4, Write: true},
+		{Cycle: 6, Addr: 0x1006, Base: 0x1000, Value: 0xdead, Size: 2},
+		{Cycle: 9, Addr: 0x10, Base: 0x10, Size: 1, Err: true, Unmapped: true},
+	}
+	r, err := NewTraceReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range exp {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec != exp[i] {
+			t.Fatalf("Record %d: expected %v, got %v", i, &exp[i], &rec)
+		}
+	}
+	if _, err = r.Next(); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+
+	var out strings.Builder
+	if err = DecodeTrace(&out, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	const text = "3: W32 @ 0x1004 = 0xdeadbeef [0x1000]\n" +
+		"6: R16 @ 0x1006 = 0xdead [0x1000]\n" +
+		"9: R8 @ 0x10 = 0x00 unmapped\n"
+	if out.String() != text {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", text, out.String())
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright © 2017 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mem
+
+import (
+	"encoding/binary"
+
+	"github.com/db47h/mirv"
+)
+
+// Uint128 is a 128 bits unsigned integer.
+//
+type Uint128 struct {
+	Lo, Hi uint64
+}
+
+// Wide is an optional interface implemented by memory types that support
+// accesses wider than 64 bits. RAM blocks created by NewRAM or NewView
+// implement Wide.
+//
+// IO devices should implement Wide if wide accesses to their registers must
+// be atomic. For memory types that do not implement it, the Bus splits wide
+// accesses into several narrower ones. Enabling access hooks (stats, tracing,
+// caches or latency) does not change the accesses seen by the memory: wide
+// accesses are only reported to the hooks as a sequence of narrower ones.
+//
+type Wide interface {
+	Read128(mirv.Address) (Uint128, error)
+	Write128(mirv.Address, Uint128) error
+
+	// ReadVector reads len(p) bytes at the given address into p, in memory
+	// order.
+	ReadVector(addr mirv.Address, p []byte) error
+	// WriteVector writes the bytes in p at the given address, in memory order.
+	WriteVector(addr mirv.Address, p []byte) error
+}
+
+func get128(p []byte, bo mirv.ByteOrder) Uint128 {
+	if bo == mirv.BigEndian {
+		return Uint128{Hi: binary.BigEndian.Uint64(p), Lo: binary.BigEndian.Uint64(p[8:])}
+	}
+	return Uint128{Lo: binary.LittleEndian.Uint64(p), Hi: binary.LittleEndian.Uint64(p[8:])}
+}
+
+func put128(p []byte, v Uint128, bo mirv.ByteOrder) {
+	if bo == mirv.BigEndian {
+		binary.BigEndian.PutUint64(p, v.Hi)
+		binary.BigEndian.PutUint64(p[8:], v.Lo)
+		return
+	}
+	binary.LittleEndian.PutUint64(p, v.Lo)
+	binary.LittleEndian.PutUint64(p[8:], v.Hi)
+}
+
+// vector returns the n bytes slice of m at address addr.
+//
+func vector(m []uint8, addr mirv.Address, n int) ([]uint8, error) {
+	if addr >= mirv.Address(len(m)) || len(m)-int(addr) < n {
+		return nil, ErrPage
+	}
+	return m[addr : int(addr)+n], nil
+}
+
+// Read128 returns the 128 bits big endian value at address addr.
+//
+func (m *bigEndian) Read128(addr mirv.Address) (Uint128, error) {
+	p, err := vector(*m, addr, 16)
+	if err != nil {
+		return Uint128{}, err
+	}
+	return get128(p, mirv.BigEndian), nil
+}
+
+// Write128 writes the 128 bits big endian value to address addr.
+//
+func (m *bigEndian) Write128(addr mirv.Address, v Uint128) error {
+	p, err := vector(*m, addr, 16)
+	if err != nil {
+		return err
+	}
+	put128(p, v, mirv.BigEndian)
+	return nil
+}
+
+// ReadVector reads len(p) bytes at address addr into p.
+//
+func (m *bigEndian) ReadVector(addr mirv.Address, p []byte) error {
+	return (*littleEndian)(m).ReadVector(addr, p)
+}
+
+// WriteVector writes the bytes in p at address addr.
+//
+func (m *bigEndian) WriteVector(addr mirv.Address, p []byte) error {
+	return (*littleEndian)(m).WriteVector(addr, p)
+}
+
+// Read128 returns the 128 bits little endian value at address addr.
+//
+func (m *littleEndian) Read128(addr mirv.Address) (Uint128, error) {
+	p, err := vector(*m, addr, 16)
+	if err != nil {
+		return Uint128{}, err
+	}
+	return get128(p, mirv.LittleEndian), nil
+}
+
+// Write128 writes the 128 bits little endian value to address addr.
+//
+func (m *littleEndian) Write128(addr mirv.Address, v Uint128) error {
+	p, err := vector(*m, addr, 16)
+	if err != nil {
+		return err
+	}
+	put128(p, v, mirv.LittleEndian)
+	return nil
+}
+
+// ReadVector reads len(p) bytes at address addr into p.
+//
+func (m *littleEndian) ReadVector(addr mirv.Address, p []byte) error {
+	v, err := vector(*m, addr, len(p))
+	if err != nil {
+		return err
+	}
+	copy(p, v)
+	return nil
+}
+
+// WriteVector writes the bytes in p at address addr.
+//
+func (m *littleEndian) WriteVector(addr mirv.Address, p []byte) error {
+	v, err := vector(*m, addr, len(p))
+	if err != nil {
+		return err
+	}
+	copy(v, p)
+	return nil
+}
+
+// wide returns the Wide interface of the memory block containing the n bytes
+// starting at addr, along with the block itself. It returns nil if the access
+// must be split into narrower ones: the block does not implement Wide or the
+// access spans several blocks.
+//
+func (b *Bus) wide(addr mirv.Address, n int) (Wide, *block) {
+	if n == 0 {
+		return nil, nil
+	}
+	blk := b.memory(addr)
+	if w, ok := blk.m.(Wide); ok && blk.contains(addr+mirv.Address(n-1)) && addr+mirv.Address(n-1) >= addr {
+		return w, blk
+	}
+	return nil, nil
+}
+
+// vsize returns the size reported in bus errors for a vector access of the
+// bytes in p.
+//
+func vsize(p []byte) uint8 {
+	if len(p) > 255 {
+		return 0
+	}
+	return uint8(len(p))
+}
+
+// wideHooks runs the access hooks for a wide access to blk of the bytes in p,
+// in memory order, starting at address addr. Since stats, traces and caches
+// only know about accesses of up to 64 bits, the access is reported as the
+// sequence of naturally aligned accesses that narrow would perform. The
+// memory itself only sees the wide access.
+//
+func (b *Bus) wideHooks(blk *block, op Op, addr mirv.Address, p []byte, err error) {
+	be := blk.m.ByteOrder() == mirv.BigEndian
+	for len(p) > 0 {
+		var n int
+		switch {
+		case addr&7 == 0 && len(p) >= 8:
+			n = 8
+		case addr&3 == 0 && len(p) >= 4:
+			n = 4
+		case addr&1 == 0 && len(p) >= 2:
+			n = 2
+		default:
+			n = 1
+		}
+		var v uint64
+		for i := 0; i < n; i++ {
+			if be {
+				v = v<<8 | uint64(p[i])
+			} else {
+				v |= uint64(p[i]) << (i * 8)
+			}
+		}
+		b.hook(blk, op, uint8(n), addr, v, err)
+		addr, p = addr+mirv.Address(n), p[n:]
+	}
+}
+
+// Read128 returns the 128 bits value at address addr.
+//
+// Misaligned accesses follow the alignment policy set by SetAlignment.
+//
+func (b *Bus) Read128(addr mirv.Address) (Uint128, error) {
+	if addr&15 != 0 && b.a == AlignTrap {
+		return Uint128{}, &ErrMisaligned{Op: OpRead, Size: 16, Addr: addr}
+	}
+	if w, blk := b.wide(addr, 16); w != nil {
+		v, err := w.Read128(addr - blk.s)
+		if err != nil {
+			err = blk.error(OpRead, 16, addr, err)
+		}
+		if b.h {
+			var p [16]byte
+			put128(p[:], v, blk.m.ByteOrder())
+			b.wideHooks(blk, OpRead, addr, p[:], err)
+		}
+		return v, err
+	}
+	var p [16]byte
+	if err := b.narrow(OpRead, addr, p[:]); err != nil {
+		return Uint128{}, err
+	}
+	return get128(p[:], b.memory(addr).m.ByteOrder()), nil
+}
+
+// Write128 writes the 128 bits value to address addr.
+//
+// Misaligned accesses follow the alignment policy set by SetAlignment.
+//
+func (b *Bus) Write128(addr mirv.Address, v Uint128) error {
+	if addr&15 != 0 && b.a == AlignTrap {
+		return &ErrMisaligned{Op: OpWrite, Size: 16, Addr: addr}
+	}
+	if w, blk := b.wide(addr, 16); w != nil {
+		err := w.Write128(addr-blk.s, v)
+		if err != nil {
+			err = blk.error(OpWrite, 16, addr, err)
+		}
+		if b.h {
+			var p [16]byte
+			put128(p[:], v, blk.m.ByteOrder())
+			b.wideHooks(blk, OpWrite, addr, p[:], err)
+		}
+		return err
+	}
+	var p [16]byte
+	put128(p[:], v, b.memory(addr).m.ByteOrder())
+	return b.narrow(OpWrite, addr, p[:])
+}
+
+// ReadVector reads len(p) bytes at address addr into p, in memory order. The
+// access can span several contiguous memory blocks. Vector accesses are not
+// subject to the alignment policy.
+//
+func (b *Bus) ReadVector(addr mirv.Address, p []byte) error {
+	if w, blk := b.wide(addr, len(p)); w != nil {
+		err := w.ReadVector(addr-blk.s, p)
+		if err != nil {
+			err = blk.error(OpRead, vsize(p), addr, err)
+		}
+		if b.h {
+			b.wideHooks(blk, OpRead, addr, p, err)
+		}
+		return err
+	}
+	return b.narrow(OpRead, addr, p)
+}
+
+// WriteVector writes the bytes in p at address addr, in memory order. The
+// access can span several contiguous memory blocks. Vector accesses are not
+// subject to the alignment policy.
+//
+func (b *Bus) WriteVector(addr mirv.Address, p []byte) error {
+	if w, blk := b.wide(addr, len(p)); w != nil {
+		err := w.WriteVector(addr-blk.s, p)
+		if err != nil {
+			err = blk.error(OpWrite, vsize(p), addr, err)
+		}
+		if b.h {
+			b.wideHooks(blk, OpWrite, addr, p, err)
+		}
+		return err
+	}
+	return b.narrow(OpWrite, addr, p)
+}
+
+// narrow performs a wide access as a sequence of naturally aligned 64, 32, 16
+// or 8 bits accesses.
+//
+func (b *Bus) narrow(op Op, addr mirv.Address, p []byte) error {
+	for len(p) > 0 {
+		var err error
+		switch {
+		case addr&7 == 0 && len(p) >= 8:
+			err = narrowN[uint64](b, op, addr, p[:8])
+			addr, p = addr+8, p[8:]
+		case addr&3 == 0 && len(p) >= 4:
+			err = narrowN[uint32](b, op, addr, p[:4])
+			addr, p = addr+4, p[4:]
+		case addr&1 == 0 && len(p) >= 2:
+			err = narrowN[uint16](b, op, addr, p[:2])
+			addr, p = addr+2, p[2:]
+		default:
+			err = narrowN[uint8](b, op, addr, p[:1])
+			addr, p = addr+1, p[1:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// narrowN transfers the value of type T at address addr from or to p,
+// according to the byte order of the memory block containing addr.
+//
+func narrowN[T word](b *Bus, op Op, addr mirv.Address, p []byte) error {
+	be := b.memory(addr).m.ByteOrder() == mirv.BigEndian
+	if op == OpWrite {
+		var v uint64
+		for i := range p {
+			if be {
+				v = v<<8 | uint64(p[i])
+			} else {
+				v |= uint64(p[i]) << (i * 8)
+			}
+		}
+		return write(b, addr, T(v))
+	}
+	v, err := read[T](b, op, addr)
+	if err != nil {
+		return err
+	}
+	for i := range p {
+		if be {
+			p[len(p)-1-i] = uint8(v >> (i * 8))
+		} else {
+			p[i] = uint8(v >> (i * 8))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package mem
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/db47h/mirv"
+)
+
+func TestBus_Read128(t *testing.T) {
+	for _, bo := range []mirv.ByteOrder{mirv.LittleEndian, mirv.BigEndian} {
+		var b Bus
+		b.Map(0, NewRAM(psz, bo))
+		b.Map(psz, &ioMem{NewRAM(psz, bo)}) // narrow only
+		v := Uint128{Lo: 0x0706050403020100, Hi: 0x0f0e0d0c0b0a0908}
+		for _, addr := range []mirv.Address{0x10, psz + 0x10, psz - 8} {
+			if err := b.Write128(addr, v); err != nil {
+				t.Fatal(err)
+			}
+			r, err := b.Read128(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != v {
+				t.Fatalf("%v @ %#x: expected %#x, got %#x", bo, addr, v, r)
+			}
+			lo, hi := addr, addr+8
+			if bo == mirv.BigEndian {
+				lo, hi = hi, lo
+			}
+			l, _ := b.Read64(lo)
+			h, _ := b.Read64(hi)
+			if l != v.Lo || h != v.Hi {
+				t.Fatalf("%v @ %#x: expected %#x, got {%#x %#x}", bo, addr, v, l, h)
+			}
+		}
+	}
+}
+
+func TestBus_ReadVector(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.BigEndian))
+	b.Map(psz, &ioMem{NewRAM(psz, mirv.LittleEndian)})
+	p := make([]byte, 37)
+	for i := range p {
+		p[i] = byte(i + 1)
+	}
+	for _, addr := range []mirv.Address{3, psz + 5, psz - 17} {
+		if err := b.WriteVector(addr, p); err != nil {
+			t.Fatal(err)
+		}
+		q := make([]byte, len(p))
+		if err := b.ReadVector(addr, q); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, q) {
+			t.Fatalf("@ %#x: expected % x, got % x", addr, p, q)
+		}
+		for i := range p {
+			if c, _ := b.Read8(addr + mirv.Address(i)); c != p[i] {
+				t.Fatalf("@ %#x: expected %#x, got %#x", addr+mirv.Address(i), p[i], c)
+			}
+		}
+	}
+	var e *ErrBus
+	if err := b.ReadVector(psz*2-4, p); !errors.As(err, &e) || e.Addr != psz*2 {
+		t.Fatalf("Expected bus error @ %#x, got %v", psz*2, err)
+	}
+}
+
+func TestBus_Read128_misaligned(t *testing.T) {
+	var b Bus
+	b.Map(0, NewRAM(psz, mirv.LittleEndian))
+	b.SetAlignment(AlignTrap)
+	if err := b.Write128(16, Uint128{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	var e *ErrMisaligned
+	if _, err := b.Read128(8); !errors.As(err, &e) || e.Size != 16 || e.Addr != 8 {
+		t.Fatalf("Expected misaligned error, got %v", err)
+	}
+	b.SetAlignment(AlignSplit)
+	if v, err := b.Read128(8); err != nil || v != (Uint128{Lo: 0, Hi: 1}) {
+		t.Fatalf("Expected {0 1}, got %v, %v", v, err)
+	}
+}
+
+// wideDev is an IO device that counts wide and narrow accesses.
+type wideDev struct {
+	ioMem
+	wide, narrow int
+}
+
+func (d *wideDev) Read32(addr mirv.Address) (uint32, error) {
+	d.narrow++
+	return d.ioMem.Read32(addr)
+}
+
+func (d *wideDev) Read64(addr mirv.Address) (uint64, error) {
+	d.narrow++
+	return d.ioMem.Read64(addr)
+}
+
+func (d *wideDev) Read128(addr mirv.Address) (Uint128, error) {
+	d.wide++
+	return d.Interface.(Wide).Read128(addr)
+}
+
+func (d *wideDev) Write128(addr mirv.Address, v Uint128) error {
+	d.wide++
+	return d.Interface.(Wide).Write128(addr, v)
+}
+
+func (d *wideDev) ReadVector(addr mirv.Address, p []byte) error {
+	d.wide++
+	return d.Interface.(Wide).ReadVector(addr, p)
+}
+
+func (d *wideDev) WriteVector(addr mirv.Address, p []byte) error {
+	d.wide++
+	return d.Interface.(Wide).WriteVector(addr, p)
+}
+
+// TestBus_Read128_hooked checks that enabling hooks does not change the
+// accesses seen by a device.
+func TestBus_Read128_hooked(t *testing.T) {
+	var b Bus
+	d := &wideDev{ioMem: ioMem{NewRAM(psz, mirv.BigEndian)}}
+	b.Map(0, d)
+	b.SetStats(true)
+	var buf bytes.Buffer
+	tr := NewTracer(&buf, nil)
+	b.SetTracer(tr)
+
+	v := Uint128{Lo: 0x0706050403020100, Hi: 0x0f0e0d0c0b0a0908}
+	if err := b.Write128(16, v); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := b.Read128(16); err != nil || r != v {
+		t.Fatalf("Expected %#x, got %#x, %v", v, r, err)
+	}
+	if err := b.ReadVector(1, make([]byte, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if d.wide != 3 || d.narrow != 0 {
+		t.Fatalf("Expected 3 wide and 0 narrow accesses, got %d and %d", d.wide, d.narrow)
+	}
+	// hooks see the equivalent narrow accesses
+	s := b.Stats()[0].Stats
+	if s.Writes != [4]uint64{0, 0, 0, 2} || s.Reads != [4]uint64{1, 1, 1, 2} {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+	tr.Flush()
+	r, err := NewTraceReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := r.Next()
+	if err != nil || rec.Size != 8 || rec.Addr != 16 || rec.Value != v.Hi {
+		t.Fatalf("Unexpected first trace record %+v, %v", rec, err)
+	}
+}
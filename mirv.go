@@ -30,8 +30,10 @@
 //	bus.Map(0, sram)							// Map RAM
 //	bus.Map(0x80000000, pic)					// Map IO
 //	cpu.Reset()									// Reset CPU
-//	for {
-//		cpu.Step(1000000)						// Run it
+//	for {										// Run it
+//		if _, err := cpu.Step(1000000); err != nil {
+//			log.Fatal(err)						// CPU fault
+//		}
 //	}
 //
 // Note that the memory Interface if byte order sensitive. While this
@@ -39,15 +41,22 @@
 // limit the number of methods in the interface, as well as making
 // it easier to implement IO devices.
 //
+// RAM blocks can however be accessed with different byte orders through views
+// sharing the same backing memory (see mem.NewView). This is useful for CPUs
+// that can switch byte order at run time or for shared memory between CPUs of
+// different byte orders.
+//
 // Memory access is being the hotest code path, it's been carefully designed to
 // use static dispatching of methods as much as possible (i.e. almost no Go
 // interfaces) and allow aggressive inlining.
 //
-// Regarding inlining and the memory interface, this is one situation where
-// generics could have been useful. To work around this limitation, the RAM and
-// Bus memory interfaces are automatically generated in order to do some manual
-// inlining without error prone copy/paste. Memory performance can be almost
-// doubled by compiling with -gcflags "-l -l -l -l".
+// The RAM memory interfaces are implemented with generic functions
+// parameterized by the access width. Since each width gets its own instance,
+// the width dependent code paths are resolved at compile time. The Bus access
+// methods only handle aligned accesses to the preferred memory block with no
+// access hook enabled, which they pass directly to the block. Everything else
+// is delegated to out of line generic functions. Memory
+// performance can be almost doubled by compiling with -gcflags "-l -l -l -l".
 //
 package mirv
 